@@ -6,9 +6,17 @@ import (
 )
 
 var fs = http.Dir("assets")
+var catalog = http.Dir("paizo/catalog")
 
 func main() {
 	if err := vfsgen.Generate(fs, vfsgen.Options{Filename: "server/assets_vfsdata.go"}); err != nil {
 		panic(err)
 	}
+	if err := vfsgen.Generate(catalog, vfsgen.Options{
+		Filename:     "paizo/catalog_vfsdata.go",
+		PackageName:  "paizo",
+		VariableName: "catalogAssets",
+	}); err != nil {
+		panic(err)
+	}
 }
@@ -27,10 +27,10 @@ class Job {
         return new Job(
             object["JobId"],
             object["State"],
-            object["Sessions"].map(Session.fromObject),
-            object["Messages"].map(Message.fromObject),
+            (object["Sessions"] || []).map(Session.fromObject),
+            (object["Messages"] || []).map(Message.fromObject),
             new Date(object["JobDate"]),
-            object["Characters"].map(Character.fromObject),
+            (object["Characters"] || []).map(Character.fromObject),
         );
     }
 }
@@ -44,12 +44,16 @@ class Session {
      * @param {number} Number
      * @param {string} Variant
      * @param {string} ScenarioName
+     * @param {string} Type
      * @param {number[]} Character
      * @param {boolean} Player
      * @param {boolean} GM
+     * @param {number} Prestige
+     * @param {number} Points
+     * @param {string} Faction
      * @constructor
      */
-    constructor(Date, EventNumber, Game, Season, Number, Variant, ScenarioName, Character, Player, GM) {
+    constructor(Date, EventNumber, Game, Season, Number, Variant, ScenarioName, Type, Character, Player, GM, Prestige, Points, Faction) {
         this.Date = Date;
         this.EventNumber = EventNumber;
         this.Game = Game;
@@ -57,9 +61,13 @@ class Session {
         this.Number = Number;
         this.Variant = Variant;
         this.ScenarioName = ScenarioName;
+        this.Type = Type;
         this.Character = Character;
         this.Player = Player;
         this.GM = GM;
+        this.Prestige = Prestige;
+        this.Points = Points;
+        this.Faction = Faction;
     }
 
     /**
@@ -100,9 +108,13 @@ class Session {
             parseInt(object["Number"]),
             object["Variant"],
             object["ScenarioName"],
+            object["Type"] || "",
             characters,
             object["Player"],
             object["GM"],
+            parseInt(object["Prestige"]) || 0,
+            parseInt(object["Points"]) || 0,
+            object["Faction"] || "",
         )
     }
 }
@@ -167,15 +179,19 @@ class Character {
 }
 
 /**
+ * @param {string} [pathname] the page whose websocket to open; by default, the current page's
  * @return {string}
  */
-function WsUrl() {
+function WsUrl(pathname) {
     const url = new URL(location.href);
     if (url.protocol.startsWith("https")) {
         url.protocol = "wss"
     } else {
         url.protocol = "ws"
     }
+    if (pathname !== undefined) {
+        url.pathname = pathname;
+    }
     url.pathname += "/ws";
 
     console.log(url.href);
@@ -208,7 +224,11 @@ function Status() {
     const jobState = document.getElementById("jobState");
     const ws = new WebSocket(WsUrl());
     ws.onmessage = ev => {
-        const message = JSON.parse(ev.data);
+        const frame = JSON.parse(ev.data);
+        if (frame["Type"] !== "message") {
+            return;
+        }
+        const message = frame["Message"];
         const messageDate = new Date(message["Time"]);
         if (lastMessage != null && messageDate <= lastMessage) {
             return;
@@ -223,6 +243,11 @@ function Status() {
             jobState.textContent = message["State"];
         }
 
+        const cancelForm = document.getElementById("cancelForm");
+        if (cancelForm !== null) {
+            cancelForm.hidden = finishedStates.includes(message["State"]);
+        }
+
         if (message["State"] === "done" && !IsView()) {
             console.log("should be done...");
             document.location = "/html?id=" + Param("id");
@@ -239,23 +264,113 @@ function Status() {
 }
 
 let job = null;
-let sortColumn = "Date";
-let sortAscend = true;
+// The server sorts sessions as given by the sort and order parameters; the table is sorted in the browser only when a
+// column header is clicked.
+let sortColumn = Param("sort");
+let sortAscend = Param("order") !== "desc";
+
+const finishedStates = ["done", "error", "cancelled"];
 
 function Html() {
     RenderHeader();
+    LoadJob(() => {
+        if (!finishedStates.includes(job.State)) {
+            Stream();
+        }
+    });
+}
 
+/**
+ * LoadJob fetches the job in the current mode and renders it.
+ * @param {function()} [then] called once the job is rendered
+ */
+function LoadJob(then) {
     const JsonUrl = new URL(location.href);
     JsonUrl.pathname = "/json";
-    JsonUrl.searchParams.set("id", Param("id"));
     fetch(JsonUrl.href).then(response => {
         return response.json();
     }).then(json => {
         job = Job.fromObject(json);
         Render(job);
+        if (then !== undefined) {
+            then();
+        }
     });
 }
 
+// streamed holds a key for each session received by Stream, since sessions read before the websocket was opened may
+// be sent again.
+const streamed = new Set();
+let renderPending = false;
+
+/**
+ * Stream adds each character and session to the job as it is read, until the job is done; then, the job is loaded
+ * again, so that its sessions are listed in the current mode.
+ */
+function Stream() {
+    const url = new URL(WsUrl("/status"));
+    url.searchParams.set("results", "true");
+    if (job.Messages.length > 0) {
+        url.searchParams.set("since", job.Messages[job.Messages.length - 1].Time.toISOString());
+    }
+    const ws = new WebSocket(url.href);
+    ws.onmessage = ev => {
+        const frame = JSON.parse(ev.data);
+        switch (frame["Type"]) {
+            case "character": {
+                const character = Character.fromObject(frame["Character"]);
+                if (!job.Characters.some(c => c.Number === character.Number)) {
+                    job.Characters.push(character);
+                }
+                break;
+            }
+            case "session": {
+                const session = Session.fromObject(frame["Session"]);
+                const key = [session.Date.valueOf(), session.EventNumber, session.Character, session.ScenarioName].join("|");
+                if (!streamed.has(key)) {
+                    streamed.add(key);
+                    job.Sessions.push(session);
+                    RenderSoon();
+                }
+                break;
+            }
+            case "message": {
+                const message = frame["Message"];
+                document.getElementById("jobState").textContent = message["State"];
+                document.getElementById("jobMessage").textContent = message["Message"];
+                // A failed or cancelled refresh is followed by "done", with the previous results.
+                if (message["State"] === "done") {
+                    ws.onclose = null;
+                    ws.close();
+                    document.getElementById("jobProgress").hidden = true;
+                    LoadJob();
+                }
+                break;
+            }
+        }
+    };
+    ws.onerror = () => {
+        ws.close();
+    };
+    ws.onclose = () => {
+        setTimeout(Stream, 1000);
+    };
+}
+
+/**
+ * RenderSoon renders the job after a short delay, so that sessions arriving together are rendered once.
+ */
+function RenderSoon() {
+    if (renderPending) {
+        return;
+    }
+    renderPending = true;
+    setTimeout(() => {
+        renderPending = false;
+        Render(job);
+    }, 250);
+}
+
 function RenderHeader() {
     const prevTableHeader = document.getElementById("jobTableHead");
     const table = prevTableHeader.parentNode;
@@ -269,7 +384,7 @@ function RenderHeader() {
         a.onclick = SortBy(column);
         a.innerText = column.Name;
         el.appendChild(a);
-        if (sortColumn === column.Name) {
+        if (sortColumn === column.Key) {
             if (sortAscend) {
                 el.appendChild(document.createTextNode("\u25b2"));
             } else {
@@ -289,10 +404,10 @@ function RenderHeader() {
  */
 function SortBy(column) {
     return function () {
-        if (sortColumn === column.Name) {
+        if (sortColumn === column.Key) {
             sortAscend = !sortAscend
         } else {
-            sortColumn = column.Name;
+            sortColumn = column.Key;
             sortAscend = true;
         }
         job.Sessions.sort((i, j) => {
@@ -300,26 +415,51 @@ function SortBy(column) {
         });
         Render(job);
         RenderHeader();
+        SetQuery({"sort": sortColumn, "order": sortAscend ? "" : "desc"});
     }
 }
 
+/**
+ * SetQuery sets the given parameters, or removes those that are empty, in the page's URL and in each link that keeps
+ * the page's query (e.g. to download the same view as CSV), so that they show the sessions as they are listed.
+ * @param {Object<string, string>} params
+ */
+function SetQuery(params) {
+    const urls = [new URL(location.href)];
+    const links = Array.from(document.getElementsByClassName("keepsQuery"));
+    links.forEach(a => urls.push(new URL(a.href)));
+    urls.forEach(url => {
+        Object.keys(params).forEach(key => {
+            if (params[key] === "") {
+                url.searchParams.delete(key);
+            } else {
+                url.searchParams.set(key, params[key]);
+            }
+        });
+    });
+    history.replaceState(null, "", urls[0].href);
+    links.forEach((a, i) => a.href = urls[i + 1].href);
+}
+
 /**
  * @param {string} Name
+ * @param {string} Key the column's sort parameter; see types.Order
  * @param {function(Session): HTMLElement} Render
  * @param {function(Session,Session,[boolean]): number} Compare
  * @param {function(Session, string[]): boolean} Select
  * @param Gadget
  * @constructor
  */
-function Column(Name, Render, Compare, Select, Gadget) {
+function Column(Name, Key, Render, Compare, Select, Gadget) {
     this.Name = Name;
+    this.Key = Key;
     this.Render = Render;
     this.Compare = Compare;
 }
 
 const Columns = [
     new Column(
-        "Date",
+        "Date", "date",
         session => {
             if (session.Date.getFullYear() === 0) {
                 return document.createTextNode("(missing)")
@@ -353,7 +493,7 @@ const Columns = [
         }, null
     ),
     new Column(
-        "System",
+        "System", "game",
         session => {
             return document.createTextNode(session.Game)
         },
@@ -363,7 +503,7 @@ const Columns = [
         null, null
     ),
     new Column(
-        "Event #",
+        "Event #", "event",
         session => {
             return document.createTextNode(
                 session
@@ -407,7 +547,7 @@ const Columns = [
         }, null, null
     ),
     new Column(
-        "Character",
+        "Character", "character",
         session => {
             let first = true;
             const span = document.createElement("SPAN");
@@ -464,7 +604,7 @@ const Columns = [
         }, null, null
     ),
     new Column(
-        "Season",
+        "Season", "season",
         session => {
             return document.createTextNode(session.Season.toString());
         },
@@ -473,7 +613,7 @@ const Columns = [
         }, null, null,
     ),
     new Column(
-        "Number",
+        "Number", "number",
         session => {
             return document.createTextNode(session.Number.toString());
         },
@@ -482,7 +622,7 @@ const Columns = [
         }, null, null,
     ),
     new Column(
-        "Variant",
+        "Variant", "variant",
         session => {
             return document.createTextNode(session.Variant);
         },
@@ -491,7 +631,16 @@ const Columns = [
         }, null, null,
     ),
     new Column(
-        "Scenario Name",
+        "Type", "type",
+        session => {
+            return document.createTextNode(session.Type);
+        },
+        (i, j) => {
+            return i.Type.localeCompare(j.Type);
+        }, null, null,
+    ),
+    new Column(
+        "Scenario Name", "name",
         session => {
             return document.createTextNode(session.ScenarioName);
         },
@@ -500,7 +649,7 @@ const Columns = [
         }, null, null,
     ),
     new Column(
-        "Player/GM",
+        "Player/GM", "role",
         session => {
             let s = "P";
             if (session.GM) {
@@ -518,6 +667,33 @@ const Columns = [
         },
         null, null,
     ),
+    new Column(
+        "Prestige", "prestige",
+        session => {
+            return document.createTextNode(session.Prestige.toString());
+        },
+        (i, j) => {
+            return i.Prestige - j.Prestige;
+        }, null, null,
+    ),
+    new Column(
+        "Points", "points",
+        session => {
+            return document.createTextNode(session.Points.toString());
+        },
+        (i, j) => {
+            return i.Points - j.Points;
+        }, null, null,
+    ),
+    new Column(
+        "Faction", "faction",
+        session => {
+            return document.createTextNode(session.Faction);
+        },
+        (i, j) => {
+            return i.Faction.localeCompare(j.Faction);
+        }, null, null,
+    ),
 ];
 
 /**
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pdbogen/autopfs/report"
+	"github.com/pdbogen/autopfs/types"
+	"os"
+	"strings"
+)
+
+// diffCommand compares an older job, saved as JSON or CSV, against a newer one: another file, if given, or else the
+// account's current data from Paizo.
+func diffCommand(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [flags] OLD [NEW]\n\nOLD and NEW are jobs saved from the server's "+
+			"/json page, or .csv exports. If NEW is omitted, sessions are retrieved from Paizo.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	scrape := addScrapeFlags(fs)
+	fs.Parse(args)
+	scrape.setup()
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	older := loadJobFile(fs.Arg(0))
+	var newer *types.Job
+	if fs.NArg() == 2 {
+		newer = loadJobFile(fs.Arg(1))
+	} else {
+		newer = scrape.job(false)
+	}
+
+	diff := report.Diff(*older, *newer)
+	if diff.Empty() {
+		fmt.Println("Nothing has changed.")
+		return
+	}
+	printSessions("New sessions", diff.Added)
+	printSessions("Sessions no longer reported", diff.Removed)
+	printCharacters("New characters", diff.NewCharacters)
+	printCharacters("Characters no longer reported", diff.RemovedCharacters)
+	if len(diff.Reputation) > 0 {
+		fmt.Println("Reputation:")
+		for _, r := range diff.Reputation {
+			fmt.Printf("  #%d %s, %s: %d -> %d\n", r.Character.Number, r.Character.Name, r.Key, r.Old, r.New)
+		}
+	}
+}
+
+func printSessions(title string, sessions []*types.Session) {
+	if len(sessions) == 0 {
+		return
+	}
+	fmt.Println(title + ":")
+	for _, s := range sessions {
+		fmt.Println("  " + strings.Join(s.Record()[:8], "\t"))
+	}
+}
+
+func printCharacters(title string, characters []types.Character) {
+	if len(characters) == 0 {
+		return
+	}
+	fmt.Println(title + ":")
+	for _, c := range characters {
+		fmt.Printf("  #%d %s\n", c.Number, c.Name)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pdbogen/autopfs/eligibility"
+	"os"
+	"strings"
+)
+
+// eligibilityCommand reports whether each character (or just the one named by -character) can play or GM the scenario
+// given as the only argument for credit.
+func eligibilityCommand(args []string) {
+	fs := flag.NewFlagSet("eligibility", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s eligibility [flags] SCENARIO\n\nSCENARIO is a scenario name as shown by "+
+			"Paizo, or a number such as 5-08.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	scrape := addScrapeFlags(fs)
+	character := fs.Int("character", 0, "only check the character with this number (the part after the dash)")
+	fs.Parse(args)
+	scrape.setup()
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	scenario := strings.Join(fs.Args(), " ")
+
+	checker := eligibility.New(*scrape.job(false))
+
+	var results []*eligibility.Result
+	if *character != 0 {
+		result, err := checker.Check(scenario, *character)
+		if err != nil {
+			log.Fatal(err)
+		}
+		results = append(results, result)
+	} else {
+		var err error
+		if results, err = checker.CheckAll(scenario); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, r := range results {
+		fmt.Printf("%s (#%d), %s:\n", r.CharacterName, r.Character, r.Scenario)
+		fmt.Printf("  play for credit: %s (%s)\n", yesNo(r.CanPlay), r.PlayReason)
+		fmt.Printf("  GM for credit:   %s (%s)\n", yesNo(r.CanGM), r.GMReason)
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,217 @@
+// Package eligibility answers whether a character can play or GM a scenario for credit, given what a job retrieved
+// from Paizo says they have already played.
+//
+// The rules applied are a simplification of the Organized Play replay rules:
+//
+//   - Scenarios marked Repeatable in the catalog can always be played or GMed for credit.
+//   - A character can receive credit for a scenario only once, whether that credit came from playing or GMing.
+//   - A player earns player credit for a scenario once per campaign (Pathfinder, Pathfinder Core, Starfinder, and
+//     Pathfinder 2 are separate campaigns); playing it again with another character requires a replay, such as a GM
+//     star replay, which is not tracked here.
+//   - GM credit can be applied to any character that has not yet received credit for the scenario.
+package eligibility
+
+import (
+	"fmt"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+	"strings"
+)
+
+// Result is the answer for one character and one scenario.
+type Result struct {
+	Character     int
+	CharacterName string
+	Scenario      string
+	Repeatable    bool
+	CanPlay       bool
+	PlayReason    string
+	CanGM         bool
+	GMReason      string
+}
+
+// Checker answers questions about one job's plays.
+type Checker struct {
+	Plays      []*types.Session
+	Characters []types.Character
+	Catalog    *paizo.Catalog
+}
+
+// New returns a Checker for the given job, using the current scenario catalog.
+func New(job types.Job) *Checker {
+	return &Checker{
+		Plays:      job.AllPlays(),
+		Characters: job.Characters,
+		Catalog:    paizo.CurrentCatalog(),
+	}
+}
+
+// Scenario parses a scenario as it might be typed by a person: a full name as shown by Paizo (e.g. "#5-08: The
+// Confirmation" or "Pathfinder Society Quest #14: The Swordlord's Challenge"), a bare number such as "5-08", or the
+// name of a scenario that appears in the job.
+func (c *Checker) Scenario(scenario string) (*types.Session, error) {
+	scenario = strings.TrimSpace(scenario)
+	if scenario == "" {
+		return nil, fmt.Errorf("no scenario given")
+	}
+
+	parsed := &paizo.Session{}
+	if err := parsed.ParseName(scenario); err == nil {
+		return &parsed.Session, nil
+	}
+	parsed = &paizo.Session{}
+	if err := parsed.ParseName("#" + scenario + ":"); err == nil && parsed.Season >= 0 {
+		// a bare number has no name; borrow one from a play of the same scenario, or from the catalog
+		parsed.ScenarioName = fmt.Sprintf("#%d-%02d%s", parsed.Season, parsed.Number, parsed.Variant)
+		for _, play := range c.Plays {
+			if sameScenario(play, &parsed.Session) {
+				parsed.ScenarioName = play.ScenarioName
+				return &parsed.Session, nil
+			}
+		}
+		if entry := c.entry(&parsed.Session); entry != nil {
+			parsed.ScenarioName = entry.Name
+		}
+		return &parsed.Session, nil
+	}
+
+	for _, play := range c.Plays {
+		if strings.EqualFold(play.ScenarioName, scenario) {
+			return play, nil
+		}
+	}
+	return nil, fmt.Errorf("could not make sense of scenario %q", scenario)
+}
+
+// Check reports whether the numbered character can play or GM the scenario for credit.
+func (c *Checker) Check(scenario string, character int) (*Result, error) {
+	scen, err := c.Scenario(scenario)
+	if err != nil {
+		return nil, err
+	}
+	char := c.character(character)
+	if char == nil {
+		return nil, fmt.Errorf("character %d is not one of this job's characters", character)
+	}
+	return c.check(scen, *char), nil
+}
+
+// CheckAll reports whether each of the job's characters can play or GM the scenario for credit. Characters from a
+// different game than the scenario are skipped.
+func (c *Checker) CheckAll(scenario string) ([]*Result, error) {
+	scen, err := c.Scenario(scenario)
+	if err != nil {
+		return nil, err
+	}
+	results := []*Result{}
+	for _, char := range c.Characters {
+		if scen.Game != "" && char.System.Game() != scen.Game {
+			continue
+		}
+		results = append(results, c.check(scen, char))
+	}
+	return results, nil
+}
+
+func (c *Checker) check(scen *types.Session, char types.Character) *Result {
+	res := &Result{
+		Character:     char.Number,
+		CharacterName: char.Name,
+		Scenario:      scen.ScenarioName,
+		CanPlay:       true,
+		CanGM:         true,
+	}
+
+	if entry := c.entry(scen); entry != nil && entry.Repeatable {
+		res.Repeatable = true
+		res.PlayReason = "this scenario is repeatable"
+		res.GMReason = res.PlayReason
+		return res
+	}
+
+	for _, play := range c.Plays {
+		if !sameScenario(play, scen) {
+			continue
+		}
+		for _, num := range play.Character {
+			if num == char.Number || num == -char.Number {
+				res.CanPlay, res.CanGM = false, false
+				res.PlayReason = fmt.Sprintf("%s already received credit on %s", char.Name, date(play))
+				res.GMReason = res.PlayReason
+				return res
+			}
+		}
+	}
+
+	for _, play := range c.Plays {
+		if !sameScenario(play, scen) || !play.Player {
+			continue
+		}
+		for _, num := range play.Character {
+			other := c.character(num)
+			if num <= 0 || other == nil || other.System != char.System {
+				continue
+			}
+			res.CanPlay = false
+			res.PlayReason = fmt.Sprintf("already played with %s (#%d) on %s; playing again needs a replay",
+				other.Name, other.Number, date(play))
+		}
+	}
+	if res.CanPlay {
+		res.PlayReason = "not yet played in this campaign"
+	}
+	res.GMReason = fmt.Sprintf("%s has no credit for this scenario", char.Name)
+	return res
+}
+
+func (c *Checker) character(number int) *types.Character {
+	if number < 0 {
+		number = -number
+	}
+	for i := range c.Characters {
+		if c.Characters[i].Number == number {
+			return &c.Characters[i]
+		}
+	}
+	return nil
+}
+
+func (c *Checker) entry(scen *types.Session) *paizo.CatalogEntry {
+	if c.Catalog == nil {
+		return nil
+	}
+	if scen.Season >= 0 {
+		if entry := c.Catalog.Find(scen.Game, scen.Season, scen.Number); entry != nil {
+			return entry
+		}
+	}
+	if entry := c.Catalog.Lookup(scen.ScenarioName); entry != nil {
+		return entry
+	}
+	return c.Catalog.Match(scen.ScenarioName)
+}
+
+// sameScenario compares numbered scenarios by game, season, number and variant, and everything else by name. Quests
+// and bounties share Season 0, so they are also told apart by type.
+func sameScenario(a, b *types.Session) bool {
+	if a.Season < 0 || b.Season < 0 {
+		return a.ScenarioName == b.ScenarioName
+	}
+	if unseasoned(a) || unseasoned(b) {
+		if a.Type != b.Type {
+			return false
+		}
+	}
+	return a.Game == b.Game && a.Season == b.Season && a.Number == b.Number && a.Variant == b.Variant
+}
+
+func unseasoned(s *types.Session) bool {
+	return s.Type == types.TypeQuest || s.Type == types.TypeBounty
+}
+
+func date(s *types.Session) string {
+	if s.Date.IsZero() {
+		return "an unknown date"
+	}
+	return s.Date.Format("2006-01-02")
+}
@@ -0,0 +1,117 @@
+package eligibility
+
+import (
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCatalog = `{"Version": 2, "Scenarios": [
+	{"Name": "The Confirmation", "Game": "Pathfinder", "Season": 5, "Number": 8, "Type": "Scenario", "Repeatable": true}
+]}`
+
+func testChecker(t *testing.T) *Checker {
+	catalog, err := paizo.ParseCatalog(strings.NewReader(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2018, 9, 15, 0, 0, 0, 0, time.UTC)
+	return &Checker{
+		Characters: []types.Character{
+			{System: types.Pathfinder, Number: 1, Name: "Valeros"},
+			{System: types.Pathfinder, Number: 2, Name: "Seoni"},
+			{System: types.Pathfinder2, Number: 2001, Name: "Ezren"},
+		},
+		Plays: []*types.Session{
+			// Valeros played 9-01; Seoni has not.
+			{Date: day, Game: "Pathfinder", Season: 9, Number: 1, ScenarioName: "Dawn of the Scarlet Sun",
+				Type: types.TypeScenario, Character: []int{1}, Player: true},
+			// 9-02 was GMed and credited to Seoni; no one played it.
+			{Date: day, Game: "Pathfinder", Season: 9, Number: 2, ScenarioName: "The Ghenett Rebellion",
+				Type: types.TypeScenario, Character: []int{-2}, GM: true},
+			// The Confirmation is repeatable, so playing it does not matter.
+			{Date: day, Game: "Pathfinder", Season: 5, Number: 8, ScenarioName: "The Confirmation",
+				Type: types.TypeScenario, Character: []int{1}, Player: true},
+			// Quest 1 shares Season 0 with bounty 1, but they are different adventures.
+			{Date: day, Game: "Pathfinder2", Season: 0, Number: 1, ScenarioName: "The Sandstone Secret",
+				Type: types.TypeQuest, Character: []int{2001}, Player: true},
+		},
+		Catalog: catalog,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := testChecker(t)
+	cases := []struct {
+		Scenario   string
+		Character  int
+		CanPlay    bool
+		CanGM      bool
+		Repeatable bool
+	}{
+		// already played by this character
+		{"9-01", 1, false, false, false},
+		// played by another character in the same campaign
+		{"9-01", 2, false, true, false},
+		// GM credit applied to this character
+		{"9-02", 2, false, false, false},
+		// GMed for another character, but never played
+		{"9-02", 1, true, true, false},
+		// never played
+		{"#9-03: The Bloodcove Blockade", 1, true, true, false},
+		// repeatable
+		{"5-08", 1, true, true, true},
+		{"#5-08: The Confirmation", 2, true, true, true},
+		// quests are told apart from bounties with the same number
+		{"Pathfinder Society Quest #1: The Sandstone Secret", 2001, false, false, false},
+		{"Pathfinder Society Bounty #1: The Whitefang Wyrm", 2001, true, true, false},
+		// found by name from the job's plays
+		{"dawn of the scarlet sun", 2, false, true, false},
+	}
+	for _, tc := range cases {
+		res, err := c.Check(tc.Scenario, tc.Character)
+		if err != nil {
+			t.Errorf("%q for #%d: %v", tc.Scenario, tc.Character, err)
+			continue
+		}
+		if res.CanPlay != tc.CanPlay || res.CanGM != tc.CanGM || res.Repeatable != tc.Repeatable {
+			t.Errorf("%q for #%d: got play=%v gm=%v repeatable=%v (%s; %s), want play=%v gm=%v repeatable=%v",
+				tc.Scenario, tc.Character, res.CanPlay, res.CanGM, res.Repeatable, res.PlayReason, res.GMReason,
+				tc.CanPlay, tc.CanGM, tc.Repeatable)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	c := testChecker(t)
+	cases := []struct {
+		Scenario  string
+		Character int
+	}{
+		{"", 1},
+		{"not a scenario", 1},
+		{"9-01", 3},
+	}
+	for _, tc := range cases {
+		if res, err := c.Check(tc.Scenario, tc.Character); err == nil {
+			t.Errorf("%q for #%d: got %+v, want an error", tc.Scenario, tc.Character, res)
+		}
+	}
+}
+
+func TestCheckAll(t *testing.T) {
+	c := testChecker(t)
+	results, err := c.CheckAll("9-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []int{}
+	for _, res := range results {
+		got = append(got, res.Character)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("checked characters %v, want the Pathfinder characters [1 2]", got)
+	}
+}
@@ -3,59 +3,48 @@ package main
 import (
 	"encoding/csv"
 	"flag"
-	"github.com/op/go-logging"
+	"fmt"
 	"github.com/pdbogen/autopfs/paizo"
 	"github.com/pdbogen/autopfs/types"
 	"os"
 )
 
-func main() {
-	email := flag.String("email", "", "address to use for paizo sign in")
-	pass := flag.String("password", "", "password to use for paizo sign in")
-	loglevel := flag.String("loglevel", "info", "set to DEBUG for more logging, or INFO or ERROR for less")
-	out := flag.String("out", "sessions.csv", "file to which CSV-formatted results should be saved")
-	charactersOnly := flag.Bool("characters", false, "just retrieve characters")
-	flag.Parse()
+// commands are run instead of the default CSV export when named by the first argument.
+var commands = map[string]func(args []string){
+	"eligibility": eligibilityCommand,
+	"diff":        diffCommand,
+}
 
-	lvl, err := logging.LogLevel(*loglevel)
-	if err != nil {
-		log.Fatalf("could not parse log level %q: %s", *loglevel, err)
+func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
 	}
-	logging.SetLevel(lvl, log.Module)
 
-	log.Debug("Logging in...")
-	pzo, err := paizo.Login(*email, *pass)
-	if err != nil {
-		log.Fatalf("during login: %s", err)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n       %s eligibility [flags] SCENARIO\n"+
+			"       %s diff [flags] OLD [NEW]\n", os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
 	}
-	log.Debug("Login OK!")
+	scrape := addScrapeFlags(flag.CommandLine)
+	out := flag.String("out", "sessions.csv", "file to which CSV-formatted results should be saved")
+	mode := flag.String("mode", types.ModeMerged, "how to list sessions: "+types.ModeMerged+" (one row per scenario), "+
+		types.ModePlays+" (one row per character and play), or "+types.ModeGrouped+" (plays, grouped by scenario)")
+	charactersOnly := flag.Bool("characters", false, "just retrieve characters")
+	flag.Parse()
+	scrape.setup()
 
-	log.Debug("Retrieving characters...")
-	characters, err := pzo.GetCharacters()
-	if err != nil {
-		log.Fatalf("retrieving characters: %s", err)
-	}
-	for i, c := range characters {
-		log.Infof("Character %d: %s", i, c)
-	}
+	job := scrape.job(*charactersOnly)
 	if *charactersOnly {
 		os.Exit(0)
 	}
 
-	log.Debug("Retrieving sessions...")
-	psessions, gsessions, err := pzo.GetSessions(characters, func(cur, total int) {
-		log.Debugf("%d/%d", cur, total)
-	})
+	sessions, err := job.SessionsFor(*mode)
 	if err != nil {
-		if psessions == nil {
-			log.Fatalf("retrieving sessions: %s", err)
-		} else {
-			log.Errorf("retrieving sessions: %s", err)
-		}
+		log.Fatal(err)
 	}
-	log.Infof("got %d player sessions, %d gm sessions", len(psessions), len(gsessions))
-
-	sessions := types.DeDupe(append(psessions, gsessions...))
 
 	log.Infof("Writing %d sessions out to %q...", len(sessions), *out)
 	outFile, err := os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0644))
@@ -0,0 +1,163 @@
+package paizo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// CatalogVersion is the newest catalog format understood by ParseCatalog. Version 2 added Seasons.
+const CatalogVersion = 2
+
+// CatalogEntry describes one scenario, special, or module, found by name, alias, pattern, or number.
+type CatalogEntry struct {
+	// Name is the canonical name; sessions found by Name or Aliases are given this ScenarioName.
+	Name    string
+	Aliases []string `json:",omitempty"`
+	// Patterns match unnumbered sessions, which keep their own ScenarioName and have Season and Number -1.
+	Patterns   []string `json:",omitempty"`
+	Game       string
+	Season     int
+	Number     int
+	Type       string
+	MinLevel   int  `json:",omitempty"`
+	MaxLevel   int  `json:",omitempty"`
+	Repeatable bool `json:",omitempty"`
+
+	patterns []*regexp.Regexp
+}
+
+// CatalogSeason lists the range of numbers used by one season, or by a series such as quests, which have Season 0.
+// The built-in catalog names only the scenarios that ParseName cannot work out.
+type CatalogSeason struct {
+	Game   string
+	Type   string
+	Season int
+	First  int
+	Last   int
+}
+
+// Catalog is the set of scenarios that ParseName knows about beyond what it can work out from the name alone.
+type Catalog struct {
+	Version   int
+	Scenarios []*CatalogEntry
+	Seasons   []*CatalogSeason `json:",omitempty"`
+
+	byName map[string]*CatalogEntry
+}
+
+var (
+	catalog   *Catalog
+	catalogMu = &sync.RWMutex{}
+)
+
+func init() {
+	f, err := catalogAssets.Open("/scenarios.json")
+	if err != nil {
+		panic("opening built-in scenario catalog: " + err.Error())
+	}
+	defer f.Close()
+	if catalog, err = ParseCatalog(f); err != nil {
+		panic("parsing built-in scenario catalog: " + err.Error())
+	}
+}
+
+// ParseCatalog reads a JSON catalog, in the format of catalog/scenarios.json, from r.
+func ParseCatalog(r io.Reader) (*Catalog, error) {
+	c := &Catalog{}
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, fmt.Errorf("decoding catalog: %v", err)
+	}
+	if c.Version < 1 || c.Version > CatalogVersion {
+		return nil, fmt.Errorf("catalog version %d is not supported; expected 1 through %d", c.Version, CatalogVersion)
+	}
+
+	for _, season := range c.Seasons {
+		if season.First > season.Last {
+			return nil, fmt.Errorf("%s %s season %d: first number %d is after last number %d",
+				season.Game, season.Type, season.Season, season.First, season.Last)
+		}
+	}
+
+	c.byName = map[string]*CatalogEntry{}
+	for i, entry := range c.Scenarios {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("catalog entry %d has no name", i)
+		}
+		for _, p := range entry.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("catalog entry %q: pattern %q: %v", entry.Name, p, err)
+			}
+			entry.patterns = append(entry.patterns, re)
+		}
+		if len(entry.patterns) > 0 {
+			continue
+		}
+		for _, name := range append([]string{entry.Name}, entry.Aliases...) {
+			if prev, ok := c.byName[name]; ok {
+				return nil, fmt.Errorf("catalog entries %q and %q both claim the name %q", prev.Name, entry.Name, name)
+			}
+			c.byName[name] = entry
+		}
+	}
+	return c, nil
+}
+
+// LoadCatalog reads a catalog from the named file.
+func LoadCatalog(path string) (*Catalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ParseCatalog(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// CurrentCatalog returns the catalog used by ParseName; the built-in one unless SetCatalog has been called.
+func CurrentCatalog() *Catalog {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	return catalog
+}
+
+// SetCatalog replaces the catalog used by ParseName, e.g. with one loaded from disk via LoadCatalog.
+func SetCatalog(c *Catalog) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalog = c
+}
+
+// Lookup returns the entry whose Name or one of whose Aliases is exactly name, or nil.
+func (c *Catalog) Lookup(name string) *CatalogEntry {
+	return c.byName[name]
+}
+
+// Match returns the first entry having a pattern that matches name, or nil.
+func (c *Catalog) Match(name string) *CatalogEntry {
+	for _, entry := range c.Scenarios {
+		for _, re := range entry.patterns {
+			if re.MatchString(name) {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// Find returns the numbered entry for the given game, season and scenario number, or nil.
+func (c *Catalog) Find(game string, season, number int) *CatalogEntry {
+	for _, entry := range c.Scenarios {
+		if len(entry.patterns) == 0 && entry.Game == game && entry.Season == season && entry.Number == number {
+			return entry
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package paizo
 
 import (
+	"context"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pdbogen/autopfs/types"
@@ -8,11 +9,12 @@ import (
 	"strings"
 )
 
-func (p *Paizo) GetCharacters() ([]types.Character, error) {
+func (p *Paizo) GetCharacters(ctx context.Context) ([]types.Character, error) {
+	p.ctx = ctx
 	bow := p.bow
-	pageUrl := "https://paizo.com/organizedPlay/myAccount"
+	pageUrl := p.baseUrl + myAccountPath
 
-	if err := bow.Open(pageUrl); err != nil {
+	if err := p.open(pageUrl); err != nil {
 		return nil, fmt.Errorf("opening %s: %s", pageUrl, err)
 	}
 
@@ -89,6 +91,8 @@ func (p *Paizo) GetCharacters() ([]types.Character, error) {
 			char.System = types.Pathfinder
 		case "PFC":
 			char.System = types.PathfinderCore
+		case "PF2", "PFS2":
+			char.System = types.Pathfinder2
 		default:
 			log.Errorf("unexpected system specifier %q", cells[1])
 		}
@@ -0,0 +1,88 @@
+package paizo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/pdbogen/autopfs/types"
+	"io"
+)
+
+// ReadCsv parses sessions from CSV written with CsvHeader, finding columns by their names in the header.
+func ReadCsv(r io.Reader) ([]*types.Session, error) {
+	csvR := csv.NewReader(r)
+	csvR.FieldsPerRecord = -1
+
+	header, err := csvR.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	known := map[string]bool{}
+	for _, col := range CsvHeader {
+		known[col] = true
+	}
+	columns := map[string]int{}
+	for i, col := range header {
+		if !known[col] {
+			return nil, fmt.Errorf("header column %d is %q; expected one of %q", i+1, col, CsvHeader)
+		}
+		if _, ok := columns[col]; ok {
+			return nil, fmt.Errorf("header has more than one %q column", col)
+		}
+		columns[col] = i
+	}
+	for _, col := range CsvHeader[:requiredCsvColumns] {
+		if _, ok := columns[col]; !ok {
+			return nil, fmt.Errorf("header has no %q column", col)
+		}
+	}
+
+	sessions := []*types.Session{}
+	for line := 2; ; line++ {
+		record, err := csvR.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) != len(header) {
+			return nil, fmt.Errorf("line %d: expected %d fields, but got %d", line, len(header), len(record))
+		}
+
+		// ParseRecord expects the columns of CsvHeader, in order; those missing from the file are left empty.
+		fields := make([]string, len(CsvHeader))
+		for i, col := range CsvHeader {
+			if j, ok := columns[col]; ok {
+				fields[i] = record[j]
+			}
+		}
+
+		sess, err := types.ParseRecord(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		sess.Game = guessGame(sess)
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// requiredCsvColumns is the number of columns, at the start of CsvHeader, that every export has had.
+const requiredCsvColumns = 8
+
+// guessGame returns the game of a session read from CSV: from the first character number, or else from the scenario
+// catalog, or else empty.
+func guessGame(sess *types.Session) string {
+	for _, char := range sess.Character {
+		if char > 0 {
+			return gameForCharacter(char)
+		}
+		if char < 0 && char != -2 {
+			return gameForCharacter(-char)
+		}
+	}
+	if entry := CurrentCatalog().Lookup(sess.ScenarioName); entry != nil {
+		return entry.Game
+	}
+	return ""
+}
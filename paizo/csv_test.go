@@ -0,0 +1,115 @@
+package paizo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/pdbogen/autopfs/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCsvRoundTrip(t *testing.T) {
+	sessions := []*types.Session{
+		{Date: time.Date(2019, 8, 3, 0, 0, 0, 0, time.UTC), EventNumber: []int64{54321}, Game: "Pathfinder2",
+			Season: 1, Number: 1, ScenarioName: "The Absalom Initiation", Type: types.TypeScenario,
+			Character: []int{2001}, Player: true, Prestige: 4, Points: 1, Faction: "Envoy's Alliance"},
+		{Date: time.Date(2018, 5, 5, 0, 0, 0, 0, time.UTC), EventNumber: []int64{12345, 54321}, Game: "Pathfinder",
+			Season: 5, Number: 8, Variant: "A", ScenarioName: "The Confirmation", Type: types.TypeScenario,
+			Character: []int{-1, 2}, Player: true, GM: true, Prestige: 4, Points: 3, Faction: "Grand Lodge, Scarab Sages"},
+		{EventNumber: []int64{12345}, Game: "Starfinder", Season: 1, Number: 2, ScenarioName: "Fugitive on the Red Planet",
+			Type: types.TypeScenario, Character: []int{-2}, GM: true},
+	}
+
+	buf := &bytes.Buffer{}
+	csvW := csv.NewWriter(buf)
+	csvW.Write(CsvHeader)
+	for _, sess := range sessions {
+		csvW.Write(sess.Record())
+	}
+	csvW.Flush()
+
+	got, err := ReadCsv(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(sessions) {
+		t.Fatalf("got %d sessions, want %d", len(got), len(sessions))
+	}
+	// The GM-only session has no character number from which to guess its game.
+	sessions[2].Game = ""
+	for i := range sessions {
+		if gotJs, wantJs := jsonString(got[i]), jsonString(sessions[i]); gotJs != wantJs {
+			t.Errorf("session %d:\n got: %s\nwant: %s", i, gotJs, wantJs)
+		}
+	}
+}
+
+func TestReadCsvColumns(t *testing.T) {
+	cases := []struct {
+		Name string
+		Csv  string
+		Want *types.Session
+		Err  bool
+	}{
+		{
+			Name: "before Type",
+			Csv: "Date,Event Number,Character Number,Season,Scenario Number,Variant,Scenario Name,Player/GM\n" +
+				"2018-06-02,54321,2,5,8,,The Confirmation,P\n",
+			Want: &types.Session{Date: time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC), EventNumber: []int64{54321},
+				Character: []int{2}, Game: "Pathfinder", Season: 5, Number: 8, ScenarioName: "The Confirmation",
+				Player: true},
+		},
+		{
+			Name: "with Type, before Prestige",
+			Csv: "Date,Event Number,Character Number,Season,Scenario Number,Variant,Scenario Name,Player/GM,Type\n" +
+				"2018-06-02,54321,GM,0,1,,The Sandstone Secret,GM,Quest\n",
+			Want: &types.Session{Date: time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC), EventNumber: []int64{54321},
+				Character: []int{-2}, Number: 1, ScenarioName: "The Sandstone Secret", GM: true,
+				Type: types.TypeQuest},
+		},
+		{
+			Name: "reordered",
+			Csv: "Scenario Name,Player/GM,Date,Event Number,Character Number,Season,Scenario Number,Variant,Prestige\n" +
+				"The Confirmation,P,MISSING,,701,1,2,,2\n",
+			Want: &types.Session{Character: []int{701}, Game: "Starfinder", Season: 1, Number: 2,
+				ScenarioName: "The Confirmation", Player: true, Prestige: 2},
+		},
+		{
+			Name: "missing Player/GM",
+			Csv:  "Date,Event Number,Character Number,Season,Scenario Number,Variant,Scenario Name\n",
+			Err:  true,
+		},
+		{
+			Name: "unknown column",
+			Csv:  "Date,Event Number,Character Number,Season,Scenario Number,Variant,Scenario Name,Player/GM,Fun\n",
+			Err:  true,
+		},
+		{
+			Name: "short record",
+			Csv: "Date,Event Number,Character Number,Season,Scenario Number,Variant,Scenario Name,Player/GM\n" +
+				"2018-06-02,54321,2,5,8,,The Confirmation\n",
+			Err: true,
+		},
+	}
+	for _, tc := range cases {
+		got, err := ReadCsv(strings.NewReader(tc.Csv))
+		if tc.Err {
+			if err == nil {
+				t.Errorf("%s: got no error", tc.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.Name, err)
+			continue
+		}
+		if len(got) != 1 {
+			t.Errorf("%s: got %d sessions, want 1", tc.Name, len(got))
+			continue
+		}
+		if gotJs, wantJs := jsonString(got[0]), jsonString(tc.Want); gotJs != wantJs {
+			t.Errorf("%s:\n got: %s\nwant: %s", tc.Name, gotJs, wantJs)
+		}
+	}
+}
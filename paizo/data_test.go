@@ -0,0 +1,162 @@
+package paizo
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"github.com/pdbogen/autopfs/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files from the current parser output instead of comparing against them. Review the
+// resulting diff before committing it.
+var update = flag.Bool("update", false, "rewrite testdata/*.golden.json from current output")
+
+type nameCase struct {
+	Name    string
+	Session types.Session
+	Error   string `json:",omitempty"`
+}
+
+type cellsInput struct {
+	Characters []types.Character
+	Rows       [][]string
+}
+
+type cellsCase struct {
+	Cells   []string
+	Session *types.Session `json:",omitempty"`
+	Error   string         `json:",omitempty"`
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// jsonString is used to compare results, so that times compare the same way they were stored in the golden files.
+func jsonString(v interface{}) string {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(js)
+}
+
+func readNames(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening %s: %v", path, err)
+	}
+	defer f.Close()
+
+	names := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "# ") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return names
+}
+
+// golden compares got against the JSON in the named golden file, or rewrites the file if -update was given. want must
+// be a pointer to a value of the same type as got.
+func golden(t *testing.T, path string, got interface{}, want interface{}) {
+	if *update {
+		js, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatalf("marshaling %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, append(js, '\n'), 0644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+		return
+	}
+
+	js, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s (run `go test -update` to create it): %v", path, err)
+	}
+	if err := json.Unmarshal(js, want); err != nil {
+		t.Fatalf("parsing %s: %v", path, err)
+	}
+}
+
+func TestParseNameGolden(t *testing.T) {
+	names := readNames(t, filepath.Join("testdata", "names.txt"))
+
+	got := []nameCase{}
+	for _, name := range names {
+		s := &Session{}
+		err := s.ParseName(name)
+		got = append(got, nameCase{Name: name, Session: s.Session, Error: errString(err)})
+	}
+
+	want := []nameCase{}
+	golden(t, filepath.Join("testdata", "names.golden.json"), got, &want)
+	if *update {
+		return
+	}
+
+	wantByName := map[string]nameCase{}
+	for _, c := range want {
+		wantByName[c.Name] = c
+	}
+	for _, c := range got {
+		w, ok := wantByName[c.Name]
+		if !ok {
+			t.Errorf("%q: no golden record; run `go test -update`", c.Name)
+			continue
+		}
+		if gotJs, wantJs := jsonString(c), jsonString(w); gotJs != wantJs {
+			t.Errorf("%q:\n got: %s\nwant: %s", c.Name, gotJs, wantJs)
+		}
+	}
+	if len(want) != len(got) {
+		t.Errorf("golden file has %d records but names.txt has %d; run `go test -update`", len(want), len(got))
+	}
+}
+
+func TestSessionFromCellsGolden(t *testing.T) {
+	js, err := ioutil.ReadFile(filepath.Join("testdata", "cells.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := cellsInput{}
+	if err := json.Unmarshal(js, &in); err != nil {
+		t.Fatalf("parsing cells.json: %v", err)
+	}
+
+	got := []cellsCase{}
+	for _, cells := range in.Rows {
+		sess, err := sessionFromCells(in.Characters, cells)
+		got = append(got, cellsCase{Cells: cells, Session: sess, Error: errString(err)})
+	}
+
+	want := []cellsCase{}
+	golden(t, filepath.Join("testdata", "cells.golden.json"), got, &want)
+	if *update {
+		return
+	}
+
+	if len(want) != len(got) {
+		t.Fatalf("golden file has %d records but cells.json has %d rows; run `go test -update`", len(want), len(got))
+	}
+	for i := range got {
+		if gotJs, wantJs := jsonString(got[i]), jsonString(want[i]); gotJs != wantJs {
+			t.Errorf("row %d %q:\n got: %s\nwant: %s", i, strings.Join(got[i].Cells, "|"), gotJs, wantJs)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package fixture serves recorded copies of the Paizo pages that the paizo package scrapes, so that the whole
+// login, characters and sessions pipeline can be exercised without live credentials.
+package fixture
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Email and Password are the only credentials the fixture server accepts.
+const (
+	Email    = "player@example.com"
+	Password = "hunter2"
+)
+
+const sessionCookie = "autopfs-fixture"
+
+// Handler serves the recorded pages. Requests for the My Account or All Sessions pages without a session cookie
+// receive the sign-in page, just like the real site.
+type Handler struct {
+	Email    string
+	Password string
+	// ExpireAfter, if non-zero, signs a session out after it has loaded that many pages, as Paizo sometimes does
+	// partway through reading All Sessions.
+	ExpireAfter int
+
+	mu sync.Mutex
+	// sessions holds the number of pages loaded by each signed-in session.
+	sessions map[string]int
+}
+
+// NewHandler returns a Handler that accepts the fixture Email and Password.
+func NewHandler() *Handler {
+	return &Handler{
+		Email:    Email,
+		Password: Password,
+		sessions: map[string]int{},
+	}
+}
+
+// NewServer starts and returns an httptest.Server running a new Handler. Its URL is suitable for use as both the
+// BaseUrl and SecureUrl of paizo.Options. The caller should Close it when done.
+func NewServer() *httptest.Server {
+	return httptest.NewServer(NewHandler())
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/organizedPlay/myAccount":
+		if !h.signedIn(req) {
+			h.write(rw, signInPage)
+			return
+		}
+		h.write(rw, myAccountPage)
+	case "/cgi-bin/WebObjects/Store.woa/wa/signIn":
+		h.signIn(rw, req)
+	case "/cgi-bin/WebObjects/Store.woa/wa/browse":
+		if req.URL.Query().Get("path") != "organizedPlay/myAccount/allsessions" {
+			http.NotFound(rw, req)
+			return
+		}
+		if !h.signedIn(req) {
+			h.write(rw, signInPage)
+			return
+		}
+		page := 0
+		fmt.Sscanf(req.URL.Query().Get("page"), "%d", &page)
+		if page < 0 || page >= len(allSessionsPages) {
+			http.NotFound(rw, req)
+			return
+		}
+		h.write(rw, allSessionsPages[page])
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func (h *Handler) signIn(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.PostFormValue("e") != h.Email || req.PostFormValue("zzz") != h.Password {
+		h.write(rw, signInFailedPage)
+		return
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := fmt.Sprintf("%x", tokenBytes)
+
+	h.mu.Lock()
+	if h.sessions == nil {
+		h.sessions = map[string]int{}
+	}
+	h.sessions[token] = 0
+	h.mu.Unlock()
+
+	http.SetCookie(rw, &http.Cookie{Name: sessionCookie, Value: token, Path: "/"})
+	http.Redirect(rw, req, "/organizedPlay/myAccount", http.StatusFound)
+}
+
+// signedIn returns true if the request is from a signed-in session, and counts the page against the session's
+// ExpireAfter.
+func (h *Handler) signedIn(req *http.Request) bool {
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	pages, ok := h.sessions[cookie.Value]
+	if !ok {
+		return false
+	}
+	if h.ExpireAfter > 0 && pages >= h.ExpireAfter {
+		delete(h.sessions, cookie.Value)
+		return false
+	}
+	h.sessions[cookie.Value] = pages + 1
+	return true
+}
+
+func (h *Handler) write(rw http.ResponseWriter, page string) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	fmt.Fprint(rw, page)
+}
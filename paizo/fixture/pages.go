@@ -0,0 +1,176 @@
+package fixture
+
+// The pages below are trimmed recordings of the paizo.com pages used by the paizo package. Only the markup that the
+// scraper looks at has been kept; personal details have been replaced.
+
+const signInPage = `<!DOCTYPE html>
+<html>
+<head><title>paizo.com - Sign In</title></head>
+<body>
+<div class="bb-content">
+    <form method="post" action="/cgi-bin/WebObjects/Store.woa/wa/signIn">
+        <input type="text" name="e" value="">
+        <input type="password" name="zzz" value="">
+        <input type="submit" name="signIn" value="Sign In">
+    </form>
+</div>
+</body>
+</html>
+`
+
+const signInFailedPage = `<!DOCTYPE html>
+<html>
+<head><title>paizo.com - Sign In</title></head>
+<body>
+<div class="bb-content">
+    <div class="alert-message">The email address or password you entered is incorrect.</div>
+    <form method="post" action="/cgi-bin/WebObjects/Store.woa/wa/signIn">
+        <input type="text" name="e" value="">
+        <input type="password" name="zzz" value="">
+        <input type="submit" name="signIn" value="Sign In">
+    </form>
+</div>
+</body>
+</html>
+`
+
+const myAccountPage = `<!DOCTYPE html>
+<html>
+<head><title>paizo.com - My Organized Play</title></head>
+<body>
+<div class="bb-content">
+<div>
+<table>
+<thead>
+<tr><th>Number</th><th>System</th><th>Name</th><th>Reputation</th><th>Faction</th></tr>
+</thead>
+<tbody>
+<tr>
+    <td>#123456-1</td>
+    <td>RPG</td>
+    <td>Valeros</td>
+    <td>
+        Total Reputation: 14
+        Grand Lodge:
+        14
+        Fame: 16
+    </td>
+    <td><a href="#"><img src="grandLodge.png" alt="Grand Lodge"></a></td>
+</tr>
+<tr>
+    <td>#123456-2</td>
+    <td>RPG</td>
+    <td>Seoni</td>
+    <td>
+        Total Reputation: 4
+        Scarab Sages:
+        4
+        Fame: 4
+    </td>
+    <td><a href="#"><img src="scarabSages.png" alt="Scarab Sages"></a></td>
+</tr>
+<tr>
+    <td>#123456-2001</td>
+    <td>PF2</td>
+    <td>Ezren</td>
+    <td>
+        Envoy's Alliance:
+        4
+    </td>
+    <td><a href="#"><img src="envoysAlliance.png" alt="Envoy's Alliance"></a></td>
+</tr>
+<tr>
+    <td>#123456-701</td>
+    <td>STAR</td>
+    <td>Navasi</td>
+    <td>
+        Fame: 4
+        Dataphiles:
+        4
+    </td>
+    <td><a href="#"><img src="dataphiles.png" alt="Dataphiles"></a></td>
+</tr>
+</tbody>
+</table>
+</div>
+</div>
+</body>
+</html>
+`
+
+const allSessionsHead = `<!DOCTYPE html>
+<html>
+<head><title>paizo.com - My Organized Play: All Sessions</title></head>
+<body>
+<div class="bb-content">
+<div id="results">
+<table>
+<tr>
+    <th>Date</th><th>GM</th><th>Scenario</th><th>Points</th><th>Event</th><th>Event Name</th><th>Session</th>
+    <th>Player</th><th>Character</th><th>Faction</th><th>Prestige</th><th>Notes</th>
+</tr>
+`
+
+const allSessionsFoot = `</table>
+</div>
+</div>
+</body>
+</html>
+`
+
+// allSessionsPages holds the All Sessions pages, newest sessions first.
+var allSessionsPages = []string{
+	allSessionsHead + `<tr><td colspan="12">1 to 4 of 9</td></tr>
+<tr>
+    <td><time datetime="2019-08-03T00:00:00Z">August 3, 2019</time></td><td></td>
+    <td>Pathfinder Society Scenario #1-01: The Absalom Initiation</td><td>1</td><td>54321</td><td>Lodge Night</td><td>1</td>
+    <td>123456-2001</td><td>Ezren</td><td>Envoy's Alliance</td><td>4</td><td></td>
+</tr>
+<tr>
+    <td><time datetime="2018-09-15T00:00:00Z">September 15, 2018</time></td><td></td>
+    <td>#9–01: Dawn of the Scarlet Sun</td><td>1</td><td>54321</td><td>Lodge Night</td><td>1</td>
+    <td>123456-2</td><td>Seoni</td><td>Scarab Sages</td><td>2</td><td></td>
+</tr>
+<tr>
+    <td><time datetime="2018-08-11T00:00:00Z">August 11, 2018</time></td><td></td>
+    <td>Starfinder Society Scenario #1–02: Fugitive on the Red Planet</td><td>1</td><td>54321</td><td>Lodge Night</td><td>2</td>
+    <td>123456-701</td><td>Navasi</td><td>Dataphiles</td><td>2</td><td></td>
+</tr>
+<tr>
+    <td><time datetime="2018-07-20T00:00:00Z">July 20, 2018</time></td><td>GM</td>
+    <td>Special: Blood Under Absalom</td><td>1</td><td>12345</td><td>PaizoCon</td><td>3</td>
+    <td>123456-1</td><td>Valeros</td><td>Grand Lodge</td><td>2 (GM)</td><td></td>
+</tr>
+<tr><td colspan="12"><a href="cgi-bin/WebObjects/Store.woa/wa/browse?path=organizedPlay/myAccount/allsessions&amp;page=1">next &gt;</a></td></tr>
+` + allSessionsFoot,
+	allSessionsHead + `<tr><td colspan="12">5 to 7 of 9</td></tr>
+<tr>
+    <td><time datetime="2018-06-02T00:00:00Z">June 2, 2018</time></td><td></td>
+    <td>#5-08: The Confirmation</td><td>1</td><td>54321</td><td>Lodge Night</td><td>1</td>
+    <td>123456-2</td><td>Seoni</td><td>Scarab Sages</td><td>2</td><td></td>
+</tr>
+<tr>
+    <td><time datetime="2018-05-05T00:00:00Z">May 5, 2018</time></td><td>GM</td>
+    <td>#5-08: The Confirmation</td><td>1</td><td>54321</td><td>Lodge Night</td><td>4</td>
+    <td>123456-1</td><td>Valeros</td><td>Grand Lodge</td><td>2 (GM)</td><td></td>
+</tr>
+<tr>
+    <td><time datetime="2018-04-14T00:00:00Z">April 14, 2018</time></td><td></td>
+    <td>Starfinder Society Scenario #1-01: The Commencement</td><td>1</td><td>54321</td><td>Lodge Night</td><td>2</td>
+    <td>123456-701</td><td>Navasi</td><td>Dataphiles</td><td>2</td><td></td>
+</tr>
+<tr><td colspan="12"><a href="cgi-bin/WebObjects/Store.woa/wa/browse?path=organizedPlay/myAccount/allsessions&amp;page=2">next &gt;</a></td></tr>
+` + allSessionsFoot,
+	allSessionsHead + `<tr><td colspan="12">8 to 9 of 9</td></tr>
+<tr>
+    <td><time datetime="2018-03-03T00:00:00Z">March 3, 2018</time></td><td></td>
+    <td>We Be Goblins!</td><td>1</td><td>12345</td><td>PaizoCon</td><td>1</td>
+    <td>123456-1</td><td>Valeros</td><td>Grand Lodge</td><td>1</td><td></td>
+</tr>
+<tr>
+    <td><time datetime="2018-02-10T00:00:00Z">February 10, 2018</time></td><td></td>
+    <td>#23: Mists of Mwangi</td><td>1</td><td>12345</td><td>PaizoCon</td><td>2</td>
+    <td>123456-1</td><td>Valeros</td><td>Grand Lodge</td><td>2</td><td></td>
+</tr>
+` + allSessionsFoot,
+}
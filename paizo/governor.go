@@ -0,0 +1,194 @@
+package paizo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Governor limits the rate and concurrency of requests to Paizo, and retries failed ones with backoff. Set its fields
+// before first use.
+type Governor struct {
+	// RequestsPerSecond is the most requests that may be started each second, or zero for no limit.
+	RequestsPerSecond float64
+	// Concurrency is the most requests each Paizo object may have outstanding, or zero for no limit.
+	Concurrency int
+	// MaxRetries is the number of times a request is retried before its failure is returned.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry, which doubles for each retry up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewGovernor returns a Governor with reasonable defaults for use against paizo.com.
+func NewGovernor() *Governor {
+	return &Governor{
+		RequestsPerSecond: 1,
+		Concurrency:       1,
+		MaxRetries:        4,
+		MinBackoff:        2 * time.Second,
+		MaxBackoff:        time.Minute,
+	}
+}
+
+// Transport returns a RoundTripper that makes requests through base subject to the Governor's limits, telling notify,
+// if non-nil, when a request is delayed or retried.
+func (g *Governor) Transport(base http.RoundTripper, notify func(msg string)) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &governedTransport{governor: g, base: base, notify: notify}
+	if g.Concurrency > 0 {
+		t.slots = make(chan struct{}, g.Concurrency)
+	}
+	return t
+}
+
+// wait blocks until the next request may be started under RequestsPerSecond, and returns how long that was.
+func (g *Governor) wait(ctx context.Context) (time.Duration, error) {
+	if g.RequestsPerSecond <= 0 {
+		return 0, nil
+	}
+	g.mu.Lock()
+	now := time.Now()
+	start := g.next
+	if start.Before(now) {
+		start = now
+	}
+	g.next = start.Add(time.Duration(float64(time.Second) / g.RequestsPerSecond))
+	g.mu.Unlock()
+
+	delay := start.Sub(now)
+	return delay, sleep(ctx, delay)
+}
+
+// sleep waits for the given duration, or until ctx is cancelled, in which case it returns ctx's error.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns how long to wait before the given retry, counting from 1.
+func (g *Governor) backoff(retry int) time.Duration {
+	d := g.MinBackoff
+	for i := 1; i < retry && d < g.MaxBackoff; i++ {
+		d *= 2
+	}
+	if g.MaxBackoff > 0 && d > g.MaxBackoff {
+		d = g.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+type governedTransport struct {
+	governor *Governor
+	base     http.RoundTripper
+	notify   func(msg string)
+	slots    chan struct{}
+}
+
+func (t *governedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.slots != nil {
+		t.slots <- struct{}{}
+		defer func() { <-t.slots }()
+	}
+
+	orig := req
+	for retry := 0; ; retry++ {
+		if retry > 0 && orig.Body != nil {
+			body, err := orig.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("rewinding request body to retry: %v", err)
+			}
+			// RoundTrippers must not modify the request, so each retry sends a copy with a fresh body.
+			req = orig.WithContext(orig.Context())
+			req.Body = body
+		}
+
+		delay, err := t.governor.wait(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		if delay > 2*time.Second {
+			t.tell("Waited %s to avoid overloading Paizo.", delay.Round(time.Second))
+		}
+
+		res, err := t.base.RoundTrip(req)
+
+		var problem string
+		switch {
+		case req.Context().Err() != nil:
+			return res, err
+		case err != nil && transient(err):
+			problem = err.Error()
+		case err != nil:
+			return nil, err
+		case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+			problem = res.Status
+		default:
+			return res, nil
+		}
+
+		if retry >= t.governor.MaxRetries || (req.Body != nil && req.GetBody == nil) {
+			return res, err
+		}
+
+		delay = t.governor.backoff(retry + 1)
+		if res != nil {
+			if seconds, convErr := strconv.Atoi(res.Header.Get("Retry-After")); convErr == nil && seconds >= 0 {
+				if max := t.governor.MaxBackoff; max > 0 && time.Duration(seconds) > max/time.Second {
+					delay = max
+				} else {
+					delay = time.Duration(seconds) * time.Second
+				}
+			}
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		log.Warningf("%s %s: %s; retrying in %s", req.Method, req.URL, problem, delay)
+		t.tell("Paizo had trouble (%s); trying again in %s (retry %d of %d)...", problem, delay.Round(100*time.Millisecond),
+			retry+1, t.governor.MaxRetries)
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *governedTransport) tell(format string, args ...interface{}) {
+	if t.notify != nil {
+		t.notify(fmt.Sprintf(format, args...))
+	}
+}
+
+// transient returns true if err looks like a network problem that might go away if the request is retried.
+func transient(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(*net.OpError); ok {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return false
+}
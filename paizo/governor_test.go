@@ -0,0 +1,57 @@
+package paizo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGovernorRetry(t *testing.T) {
+	bodies := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			// Far longer than MaxBackoff, which should cap it.
+			rw.Header().Set("Retry-After", "86400")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	g := &Governor{MaxRetries: 1, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	req, err := http.NewRequest("POST", srv.URL, strings.NewReader("e=player@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := req.Body
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		res, err := g.Transport(nil, nil).RoundTrip(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("got %s, want 200 OK", res.Status)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry-After was not capped at MaxBackoff")
+	}
+
+	if strings.Join(bodies, ",") != "e=player@example.com,e=player@example.com" {
+		t.Errorf("server got bodies %q", bodies)
+	}
+	if req.Body != body {
+		t.Error("RoundTrip replaced the request's body")
+	}
+}
@@ -1,6 +1,7 @@
 package paizo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
@@ -8,6 +9,7 @@ import (
 	"github.com/headzoo/surf/browser"
 	"github.com/op/go-logging"
 	"github.com/pdbogen/autopfs/types"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,25 +17,102 @@ import (
 
 var log = logging.MustGetLogger("paizo")
 
+// DefaultBaseUrl and DefaultSecureUrl are the scheme and host of the real Paizo site; see Options.
+const (
+	DefaultBaseUrl   = "https://paizo.com"
+	DefaultSecureUrl = "https://secure.paizo.com"
+)
+
+const (
+	myAccountPath   = "/organizedPlay/myAccount"
+	allSessionsPath = "/cgi-bin/WebObjects/Store.woa/wa/browse?path=organizedPlay/myAccount/allsessions#tabs"
+)
+
+// Options controls where a Paizo object sends its requests. The zero value talks to paizo.com; a fixture server (see
+// the fixture package) can be used instead by pointing BaseUrl and SecureUrl at it.
+type Options struct {
+	// BaseUrl is the scheme and host from which the My Account and All Sessions pages are loaded. If empty,
+	// DefaultBaseUrl is used.
+	BaseUrl string
+	// SecureUrl is the scheme and host to which the All Sessions `next >` links are relative. If empty,
+	// DefaultSecureUrl is used.
+	SecureUrl string
+	// Transport, if non-nil, is used to make every HTTP request instead of http.DefaultTransport.
+	Transport http.RoundTripper
+	// Governor, if non-nil, limits and retries every HTTP request; it is normally shared by every Paizo object in the
+	// program. See Governor.
+	Governor *Governor
+	// Notify, if non-nil, is told when the Governor delays or retries a request, or when the Paizo object has to sign
+	// in again.
+	Notify func(msg string)
+}
+
+// maxRelogins is the number of times a Paizo object will sign in again, each time it finds it has been signed out,
+// before giving up on a page.
+const maxRelogins = 2
+
+// Paizo is a signed-in session with Paizo. Its methods may not be called concurrently.
 type Paizo struct {
 	bow *browser.Browser
+	// ctx is the context of the method currently being called; see contextTransport.
+	ctx       context.Context
+	baseUrl   string
+	secureUrl string
+	email     string
+	pass      string
+	notify    func(msg string)
 }
 
 // Login creates and returns a new Paizo object with an active session. Logging in can take several seconds; so you
-// should be parsimonious about calling this; but on the flip side, sessions may terminate unexpectedly, and the code
-// currently makes no attempt to detect this.
+// should be parsimonious about calling this. Paizo sessions may terminate unexpectedly; if a page comes back as
+// anything other than My Organized Play, the Paizo object signs in again with the same credentials and reloads the
+// page.
 //
 // If Login is not able to login, a non-nil error is returned indicating why. This attempts to include any error message
 // reported by Paizo, as well.
-func Login(email, pass string) (*Paizo, error) {
+//
+// ctx applies only to logging in; each other method takes its own context. If a context is cancelled, the request in
+// progress is abandoned and the method returns an error.
+func Login(ctx context.Context, email, pass string) (*Paizo, error) {
+	return LoginWith(ctx, Options{}, email, pass)
+}
+
+// LoginWith is like Login, but uses the given Options to reach Paizo.
+func LoginWith(ctx context.Context, opts Options, email, pass string) (*Paizo, error) {
 	browserObject := surf.NewBrowser()
+	transport := opts.Transport
+	if opts.Governor != nil {
+		transport = opts.Governor.Transport(transport, opts.Notify)
+	}
 	ret := &Paizo{
-		bow: browserObject,
+		ctx:       ctx,
+		bow:       browserObject,
+		baseUrl:   strings.TrimRight(opts.BaseUrl, "/"),
+		secureUrl: strings.TrimRight(opts.SecureUrl, "/"),
+		email:     email,
+		pass:      pass,
+		notify:    opts.Notify,
+	}
+	if ret.baseUrl == "" {
+		ret.baseUrl = DefaultBaseUrl
+	}
+	if ret.secureUrl == "" {
+		ret.secureUrl = DefaultSecureUrl
 	}
+	browserObject.SetTransport(&contextTransport{paizo: ret, base: transport})
 
-	err := browserObject.Open("https://paizo.com/organizedPlay/myAccount")
+	if err := ret.login(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// login signs in to Paizo with the Paizo object's browser and credentials.
+func (p *Paizo) login() error {
+	browserObject := p.bow
+	err := browserObject.Open(p.baseUrl + myAccountPath)
 	if err != nil {
-		return nil, fmt.Errorf("opening login page: %s", err)
+		return fmt.Errorf("opening login page: %s", err)
 	}
 
 	log.Debugf("Got login page %q, %q", browserObject.Title(), browserObject.Url().String())
@@ -54,36 +133,84 @@ func Login(email, pass string) (*Paizo, error) {
 	}
 
 	if form == nil {
-		return nil, errors.New("could not find a form having an input named `e`")
+		return errors.New("could not find a form having an input named `e`")
 	}
 
-	err = form.Set("e", email)
+	err = form.Set("e", p.email)
 	if err != nil {
-		return nil, fmt.Errorf("setting email input `e`: %s", err)
+		return fmt.Errorf("setting email input `e`: %s", err)
 	}
-	err = form.Set("zzz", pass)
+	err = form.Set("zzz", p.pass)
 	if err != nil {
-		return nil, fmt.Errorf("setting password input `z`: %s", err)
+		return fmt.Errorf("setting password input `z`: %s", err)
 	}
 
 	log.Debug("email and password fields set")
 	err = form.Submit()
 	if err != nil {
-		return nil, fmt.Errorf("submitting login form: %s", err)
+		return fmt.Errorf("submitting login form: %s", err)
 	}
 
 	log.Debugf("Submitted login; now at %q", browserObject.Title())
-	if !strings.Contains(browserObject.Title(), "My Organized Play") {
+	if !signedIn(browserObject) {
 		err := fmt.Errorf("login failed! title was %q", browserObject.Title())
 		am := browserObject.Find("div.alert-message")
 		if am.Size() > 0 {
 			err = fmt.Errorf("%s; alert message was %q", err, am.Text())
 		}
-		return nil, err
+		return err
 	}
 
 	log.Debugf("Login appears successful!")
-	return ret, nil
+	return nil
+}
+
+// contextTransport makes each request with the context of the Paizo method that made it, since the browser has no
+// way to do so.
+type contextTransport struct {
+	paizo *Paizo
+	base  http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req.WithContext(t.paizo.ctx))
+}
+
+// signedIn returns true if the browser is on one of the My Organized Play pages, which Paizo shows only to users who
+// are signed in.
+func signedIn(bow *browser.Browser) bool {
+	return strings.Contains(bow.Title(), "My Organized Play")
+}
+
+// open opens the given My Organized Play page, signing in again if Paizo shows some other page instead.
+func (p *Paizo) open(pageUrl string) error {
+	for relogins := 0; ; relogins++ {
+		if err := p.ctx.Err(); err != nil {
+			return err
+		}
+		if err := p.bow.Open(pageUrl); err != nil {
+			return err
+		}
+		if signedIn(p.bow) {
+			return nil
+		}
+		if relogins >= maxRelogins {
+			return fmt.Errorf("still signed out after signing in again %d times; title was %q", relogins,
+				p.bow.Title())
+		}
+
+		log.Infof("Expected My Organized Play but got %q; signing in again", p.bow.Title())
+		if p.notify != nil {
+			p.notify("Paizo signed us out; signing in again...")
+		}
+		if err := p.login(); err != nil {
+			return fmt.Errorf("signing in again: %s", err)
+		}
+	}
 }
 
 var countRegexp = regexp.MustCompile(`\d+\s+to\s+\d+\s+of\s+(\d+)`)
@@ -110,20 +237,47 @@ func GetSessionCount(bow *browser.Browser) (int, error) {
 	return total, nil
 }
 
-// GetSessions returns a de-duplicated (see DeDupe) list of sessions for the user that the Paizo object is logged into.
-// If sessions cannot be retrieved or parse, err is non-nil. In such a case, sessions may by non-nil and still contain
+// GetSessions returns the sessions for the user that the Paizo object is logged into, one per row of All Sessions and
+// newest first; use types.DeDupe to merge them by scenario. If sessions cannot be retrieved or parse, err is non-nil. In such a case, sessions may by non-nil and still contain
 // useful data, especially if the error related to the parsing of a specific session.
-func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, total int)) (playerSessions []*types.Session, gmSessions []*types.Session, err error) {
+func (p *Paizo) GetSessions(ctx context.Context, characters []types.Character, progress func(cur, total int)) (playerSessions []*types.Session, gmSessions []*types.Session, err error) {
+	return p.GetSessionsWith(ctx, characters, SessionOptions{Progress: progress})
+}
+
+// SessionOptions controls how GetSessionsWith reads All Sessions. The zero value reads every page.
+type SessionOptions struct {
+	// Known, if non-nil, reports whether a session is already known; paging stops after the page that has one.
+	Known func(*types.Session) bool
+	// Progress, if non-nil, is called after each page with the number of sessions read so far and the total
+	// number of sessions reported by Paizo.
+	Progress func(cur, total int)
+	// StartUrl, if non-empty, is the page at which to start reading, e.g. from an earlier Checkpoint.
+	StartUrl string
+	// Checkpoint, if non-nil, is called before loading each subsequent page, with that page's URL and the sessions
+	// read so far, not including any read before StartUrl.
+	Checkpoint func(nextUrl string, playerSessions, gmSessions []*types.Session)
+	// Page, if non-nil, is called after each page with the sessions read from that page, so that they can be shown
+	// before the rest are read.
+	Page func(playerSessions, gmSessions []*types.Session)
+}
+
+// GetSessionsWith is like GetSessions, but reads All Sessions as described by the given SessionOptions.
+func (p *Paizo) GetSessionsWith(ctx context.Context, characters []types.Character, opts SessionOptions) (playerSessions []*types.Session, gmSessions []*types.Session, err error) {
+	p.ctx = ctx
+	known, progress := opts.Known, opts.Progress
 	bow := p.bow
 	parseErrors := []string{}
 
-	pageUrl := "https://paizo.com/cgi-bin/WebObjects/Store.woa/wa/browse?path=organizedPlay/myAccount/allsessions#tabs"
+	pageUrl := p.baseUrl + allSessionsPath
+	if opts.StartUrl != "" {
+		pageUrl = opts.StartUrl
+	}
 
 	if progress != nil {
 		progress(0, 0)
 	}
 
-	if err := bow.Open(pageUrl); err != nil {
+	if err := p.open(pageUrl); err != nil {
 		return nil, nil, fmt.Errorf("opening page %q: %s", pageUrl, err)
 	}
 	log.Debugf("Loaded sessions page %q", bow.Title())
@@ -131,6 +285,8 @@ func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, tot
 	gmSessions = []*types.Session{}
 
 	for {
+		reachedKnown := false
+		pagePlayer, pageGM := len(playerSessions), len(gmSessions)
 		rows := bow.Find("div#results table tr")
 		log.Debugf("found %d TRs in table in div with id=results", rows.Size())
 		for i := 0; i < rows.Size(); i++ {
@@ -164,6 +320,11 @@ func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, tot
 				}
 			}
 
+			if known != nil && known(sess) {
+				reachedKnown = true
+				continue
+			}
+
 			if sess.GM {
 				gmSessions = append(gmSessions, sess)
 			} else {
@@ -171,6 +332,10 @@ func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, tot
 			}
 		}
 
+		if opts.Page != nil {
+			opts.Page(playerSessions[pagePlayer:], gmSessions[pageGM:])
+		}
+
 		if progress != nil {
 			total, err := GetSessionCount(bow)
 			if err != nil {
@@ -180,6 +345,11 @@ func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, tot
 			}
 		}
 
+		if reachedKnown {
+			log.Debugf("reached already-known sessions; not loading any more pages")
+			break
+		}
+
 		next := bow.Find("a").FilterFunction(func(_ int, a *goquery.Selection) bool {
 			return a.Text() == "next >"
 		})
@@ -188,8 +358,11 @@ func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, tot
 			break
 		}
 
-		nextUrl := fmt.Sprintf("https://secure.paizo.com/%s", next.AttrOr("href", ""))
-		if err := bow.Open(nextUrl); err != nil {
+		nextUrl := fmt.Sprintf("%s/%s", p.secureUrl, strings.TrimLeft(next.AttrOr("href", ""), "/"))
+		if opts.Checkpoint != nil {
+			opts.Checkpoint(nextUrl, playerSessions, gmSessions)
+		}
+		if err := p.open(nextUrl); err != nil {
 			return nil, nil, fmt.Errorf("unexpected error clicking `next`: %s", err)
 		}
 	}
@@ -197,5 +370,5 @@ func (p *Paizo) GetSessions(characters []types.Character, progress func(cur, tot
 	if len(parseErrors) > 0 {
 		err = fmt.Errorf("Parse errors occurred: %s", strings.Join(parseErrors, ", "))
 	}
-	return types.DeDupe(playerSessions), types.DeDupe(gmSessions), err
+	return playerSessions, gmSessions, err
 }
@@ -0,0 +1,94 @@
+package paizo
+
+import (
+	"context"
+	"github.com/pdbogen/autopfs/paizo/fixture"
+	"github.com/pdbogen/autopfs/types"
+	"net/http/httptest"
+	"testing"
+)
+
+// scrapeFixture signs in to a fixture server running h, and reads its characters and sessions.
+func scrapeFixture(t *testing.T, h *fixture.Handler) ([]types.Character, []*types.Session, []*types.Session) {
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	ctx := context.Background()
+	p, err := LoginWith(ctx, Options{BaseUrl: srv.URL, SecureUrl: srv.URL}, fixture.Email, fixture.Password)
+	if err != nil {
+		t.Fatalf("signing in: %v", err)
+	}
+	characters, err := p.GetCharacters(ctx)
+	if err != nil {
+		t.Fatalf("getting characters: %v", err)
+	}
+
+	lastCur, lastTotal := -1, -1
+	player, gm, err := p.GetSessions(ctx, characters, func(cur, total int) { lastCur, lastTotal = cur, total })
+	if err != nil {
+		t.Fatalf("getting sessions: %v", err)
+	}
+	if lastCur != 9 || lastTotal != 9 {
+		t.Errorf("last progress was %d/%d, want 9/9", lastCur, lastTotal)
+	}
+	return characters, player, gm
+}
+
+func TestFixture(t *testing.T) {
+	characters, player, gm := scrapeFixture(t, fixture.NewHandler())
+
+	wantCharacters := []struct {
+		Name   string
+		Number int
+		System types.System
+	}{
+		{"Valeros", 1, types.Pathfinder},
+		{"Seoni", 2, types.Pathfinder},
+		{"Ezren", 2001, types.Pathfinder2},
+		{"Navasi", 701, types.Starfinder},
+	}
+	if len(characters) != len(wantCharacters) {
+		t.Fatalf("got %d characters, want %d: %+v", len(characters), len(wantCharacters), characters)
+	}
+	for i, want := range wantCharacters {
+		got := characters[i]
+		if got.Name != want.Name || got.Number != want.Number || got.System != want.System {
+			t.Errorf("character %d: got %s #%d (%v), want %s #%d (%v)", i, got.Name, got.Number, got.System,
+				want.Name, want.Number, want.System)
+		}
+	}
+
+	if len(player) != 7 || len(gm) != 2 {
+		t.Fatalf("got %d player and %d GM sessions, want 7 and 2", len(player), len(gm))
+	}
+	for _, sess := range gm {
+		if !sess.GM || sess.Player {
+			t.Errorf("GM session %q: GM=%v Player=%v", sess.ScenarioName, sess.GM, sess.Player)
+		}
+	}
+	if first := player[0]; first.Game != types.Pathfinder2.Game() || first.Season != 1 || first.Number != 1 {
+		t.Errorf("first session is %s %d-%02d, want %s 1-01", first.Game, first.Season, first.Number,
+			types.Pathfinder2.Game())
+	}
+}
+
+// TestFixtureRelogin checks that a session signed out partway through All Sessions signs in again and reads the same
+// sessions.
+func TestFixtureRelogin(t *testing.T) {
+	h := fixture.NewHandler()
+	h.ExpireAfter = 2
+	_, player, gm := scrapeFixture(t, h)
+	if len(player) != 7 || len(gm) != 2 {
+		t.Fatalf("got %d player and %d GM sessions, want 7 and 2", len(player), len(gm))
+	}
+}
+
+func TestFixtureBadPassword(t *testing.T) {
+	srv := fixture.NewServer()
+	defer srv.Close()
+
+	_, err := LoginWith(context.Background(), Options{BaseUrl: srv.URL, SecureUrl: srv.URL}, fixture.Email, "wrong")
+	if err == nil {
+		t.Fatal("signed in with the wrong password")
+	}
+}
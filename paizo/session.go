@@ -13,21 +13,7 @@ type Session struct {
 	types.Session
 }
 
-var CsvHeader = []string{"Date", "Event Number", "Character Number", "Season", "Scenario Number", "Variant", "Scenario Name", "Player/GM"}
-
-var starfinderModules, pathfinderModules, pathfinder2Modules []*regexp.Regexp
-
-func init() {
-	for _, s := range starfinderModuleStrings {
-		starfinderModules = append(starfinderModules, regexp.MustCompile(s))
-	}
-	for _, s := range pathfinderModuleStrings {
-		pathfinderModules = append(pathfinderModules, regexp.MustCompile(s))
-	}
-	for _, s := range pathfinder2ModuleStrings {
-		pathfinder2Modules = append(pathfinder2Modules, regexp.MustCompile(s))
-	}
-}
+var CsvHeader = []string{"Date", "Event Number", "Character Number", "Season", "Scenario Number", "Variant", "Scenario Name", "Player/GM", "Type", "Prestige", "Points", "Faction"}
 
 var s0s1Regex = regexp.MustCompile("^#([0-9]+):")
 var variantRegex = regexp.MustCompile(`^([0-9]+)([^0-9]+)`)
@@ -35,26 +21,39 @@ var starfinderRegex = []*regexp.Regexp{
 	regexp.MustCompile(`^Starfinder Society Scenario #([0-9]+)[-–]([0-9]+): (.*)$`),
 }
 
+// pathfinder2Regex matches Pathfinder Society (second edition) adventures. Scenarios and specials are numbered within
+// a season (#2-05); quests and bounties are numbered on their own (#5).
+var pathfinder2Regex = regexp.MustCompile(`^Pathfinder Society (Scenario|Special|Quest|Bounty) #(?:([0-9]+)[-–])?([0-9]+)([A-Za-z]*):? (.*)$`)
+
 // ParseName teases apart and stores interesting information from the scenario name- season number and scenarion number
-// and stores it in the Session object. If an error occurs, error will be non-nil; some fields may be correctly
-// populated; and the full raw scenario name will be saved in the ScenarioName field.
+// and stores it in the Session object. Specials and other scenarios that have a season number but don't include it or
+// have unique formatting, as well as modules, are looked up in the current Catalog. If an error occurs, error will be
+// non-nil; some fields may be correctly populated; and the full raw scenario name will be saved in the ScenarioName
+// field.
 func (s *Session) ParseName(raw string) error {
 	raw = strings.TrimSpace(raw)
 	sn := raw
+	cat := CurrentCatalog()
 
-	if scen, ok := staticScenarioNumbers[sn]; ok {
-		s.Season = scen.nums[0]
-		s.Number = scen.nums[1]
-		s.Game = scen.sys
-		s.ScenarioName = sn
+	if entry := cat.Lookup(sn); entry != nil {
+		s.Season = entry.Season
+		s.Number = entry.Number
+		s.Game = entry.Game
+		s.Type = entry.Type
+		s.ScenarioName = entry.Name
 		return nil
 	}
 
+	if pf2 := pathfinder2Regex.FindStringSubmatch(sn); pf2 != nil {
+		return s.parsePathfinder2(raw, pf2)
+	}
+
 	if s0s1 := s0s1Regex.FindStringSubmatch(sn); s0s1 != nil {
 		num := s0s1[1]
 		season, err := strconv.Atoi(num)
 		if err == nil {
 			s.Game = "Pathfinder"
+			s.Type = types.TypeScenario
 			s.Season = season / 29
 			s.Number = season
 			s.ScenarioName = strings.TrimSpace(sn[strings.Index(sn, " ")+1:])
@@ -71,6 +70,7 @@ func (s *Session) ParseName(raw string) error {
 			}
 			if err == nil {
 				s.Game = "Starfinder"
+				s.Type = types.TypeScenario
 				s.Season = season
 				s.Number = scenario
 				s.ScenarioName = strings.TrimSpace(sf[3])
@@ -84,25 +84,12 @@ func (s *Session) ParseName(raw string) error {
 
 	if sn[0] != '#' {
 		s.ScenarioName = strings.TrimSpace(raw)
-		for _, re := range pathfinderModules {
-			if re.MatchString(raw) {
-				s.Game = "Pathfinder"
-				return nil
-			}
-		}
-		for _, re := range pathfinder2Modules {
-			if re.MatchString(raw) {
-				s.Game = "Pathfinder2"
-				return nil
-			}
-		}
-		for _, re := range starfinderModules {
-			if re.MatchString(raw) {
-				s.Game = "Starfinder"
-				return nil
-			}
+		if entry := cat.Match(raw); entry != nil {
+			s.Game = entry.Game
+			s.Type = entry.Type
+			return nil
 		}
-		return fmt.Errorf("no parser or static record for %q", raw)
+		return fmt.Errorf("no parser or catalog entry for %q", raw)
 	}
 
 	sn = strings.TrimLeft(sn, "#")
@@ -140,6 +127,37 @@ func (s *Session) ParseName(raw string) error {
 	s.Number = number
 	s.ScenarioName = strings.TrimSpace(strings.TrimLeft(sn[term+len(s.Variant):], ":— "))
 	s.Game = "Pathfinder"
+	s.Type = types.TypeScenario
+	return nil
+}
+
+// parsePathfinder2 populates the session from the submatches of pathfinder2Regex: the adventure type, optional season,
+// number, optional variant, and title.
+func (s *Session) parsePathfinder2(raw string, pf2 []string) error {
+	s.Game = "Pathfinder2"
+	s.Type = pf2[1]
+	s.Variant = pf2[4]
+	s.ScenarioName = strings.TrimSpace(pf2[5])
+
+	s.Season = 0
+	if pf2[2] != "" {
+		season, err := strconv.Atoi(pf2[2])
+		if err != nil {
+			s.Season, s.Number = -1, -1
+			return fmt.Errorf("parsing %q: could not parse %q as season: %s", raw, pf2[2], err)
+		}
+		s.Season = season
+	} else if s.Type == types.TypeScenario || s.Type == types.TypeSpecial {
+		s.Season, s.Number = -1, -1
+		return fmt.Errorf("parsing %q: %s has no season", raw, strings.ToLower(s.Type))
+	}
+
+	number, err := strconv.Atoi(pf2[3])
+	if err != nil {
+		s.Number = -1
+		return fmt.Errorf("parsing %q: could not parse %q as number: %s", raw, pf2[3], err)
+	}
+	s.Number = number
 	return nil
 }
 
@@ -147,13 +165,37 @@ const (
 	dateCell     = 0
 	gmCell       = 1
 	scenarioCell = 2
+	pointsCell   = 3
 	eventCell    = 4
 	playerCell   = 7
 	charNameCell = 8
+	factionCell  = 9
 	prestigeCell = 10
-	maxCell      = 10
+	maxCell      = 11
 )
 
+var rewardRegex = regexp.MustCompile(`-?[0-9]+`)
+
+// parseReward returns the first integer in a reward cell such as "2" or "2 (GM)", or zero if there is none.
+func parseReward(cell string) (int, error) {
+	num := rewardRegex.FindString(cell)
+	if num == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(num)
+}
+
+// gameForCharacter guesses the game from a character number, since Paizo numbers each game's characters in its own
+// range.
+func gameForCharacter(charNum int) string {
+	if charNum > 1500 {
+		return "Pathfinder2"
+	} else if charNum >= 700 {
+		return "Starfinder"
+	}
+	return "Pathfinder"
+}
+
 // sessionFromCells converts a list of cells (a 12-long string slice corresponding to the columnar format on the paizo
 // sessions page) to a hydrated Session object. The first cell is handled specially, and is intended to be an RFC3339
 // time string, which is retrieved from the `datetime` attribute of the `time` object that occupies the first cell.
@@ -187,6 +229,14 @@ func sessionFromCells(characters []types.Character, cells []string) (*types.Sess
 	}
 	ret.EventNumber = append(ret.EventNumber, evNum)
 
+	ret.Faction = cells[factionCell]
+	if ret.Prestige, err = parseReward(cells[prestigeCell]); err != nil {
+		return &ret.Session, fmt.Errorf("could not parse prestige %q: %s", cells[prestigeCell], err)
+	}
+	if ret.Points, err = parseReward(cells[pointsCell]); err != nil {
+		return &ret.Session, fmt.Errorf("could not parse points %q: %s", cells[pointsCell], err)
+	}
+
 	if !strings.Contains(cells[prestigeCell], "GM") {
 		charNumStr := cells[playerCell]
 		charNumDash := strings.Index(charNumStr, "-")
@@ -202,13 +252,7 @@ func sessionFromCells(characters []types.Character, cells []string) (*types.Sess
 				return &ret.Session, fmt.Errorf("in seventh cell %q, could not parse character number part %q: %s", charNumStr, charNumPart, err)
 			}
 			ret.Character = append(ret.Character, charNum)
-			if charNum > 1500 {
-				ret.Game = "Pathfinder2"
-			} else if charNum >= 700 {
-				ret.Game = "Starfinder"
-			} else {
-				ret.Game = "Pathfinder"
-			}
+			ret.Game = gameForCharacter(charNum)
 		}
 		ret.Player = true
 	} else {
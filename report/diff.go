@@ -0,0 +1,110 @@
+package report
+
+import (
+	"github.com/pdbogen/autopfs/types"
+	"sort"
+)
+
+// JobDiff is what changed between two snapshots of the same account: an older job, A, and a newer one, B.
+type JobDiff struct {
+	// Added are plays in B that A does not have; Removed, plays in A that B does not have. Both are sorted by date.
+	Added   []*types.Session
+	Removed []*types.Session
+	// NewCharacters are in B but not A; RemovedCharacters, in A but not B.
+	NewCharacters     []types.Character
+	RemovedCharacters []types.Character
+	// Reputation lists each changed Character.Prestige value of characters that are in both jobs.
+	Reputation []*ReputationChange
+}
+
+// ReputationChange is a change in one of a character's Prestige values; e.g., reputation with one faction, or fame.
+type ReputationChange struct {
+	Character types.Character
+	Key       string
+	Old       int
+	New       int
+}
+
+// Empty returns true if nothing changed.
+func (d *JobDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.NewCharacters) == 0 &&
+		len(d.RemovedCharacters) == 0 && len(d.Reputation) == 0
+}
+
+// Diff compares two jobs' sessions play by play, and their characters unless either job has none.
+func Diff(a, b types.Job) *JobDiff {
+	diff := &JobDiff{
+		Added:             missing(b.AllPlays(), a.AllPlays()),
+		Removed:           missing(a.AllPlays(), b.AllPlays()),
+		NewCharacters:     []types.Character{},
+		RemovedCharacters: []types.Character{},
+		Reputation:        []*ReputationChange{},
+	}
+	if len(a.Characters) == 0 || len(b.Characters) == 0 {
+		return diff
+	}
+
+	type charKey struct {
+		System types.System
+		Number int
+	}
+	aChars := map[charKey]types.Character{}
+	for _, c := range a.Characters {
+		aChars[charKey{c.System, c.Number}] = c
+	}
+	bChars := map[charKey]bool{}
+	for _, newChar := range b.Characters {
+		bChars[charKey{newChar.System, newChar.Number}] = true
+		oldChar, ok := aChars[charKey{newChar.System, newChar.Number}]
+		if !ok {
+			diff.NewCharacters = append(diff.NewCharacters, newChar)
+			continue
+		}
+		diff.Reputation = append(diff.Reputation, reputationChanges(oldChar, newChar)...)
+	}
+	for _, oldChar := range a.Characters {
+		if !bChars[charKey{oldChar.System, oldChar.Number}] {
+			diff.RemovedCharacters = append(diff.RemovedCharacters, oldChar)
+		}
+	}
+	return diff
+}
+
+// missing returns the sessions in `in` that are not covered by the sessions in `from`, sorted by date. Sessions in
+// `from` are merged by scenario first, so that a merged session in `in` is covered by the plays it was made from.
+func missing(in, from []*types.Session) []*types.Session {
+	byName := map[string]*types.Session{}
+	for _, s := range types.DeDupe(from) {
+		byName[s.ScenarioName] = s
+	}
+
+	out := []*types.Session{}
+	for _, s := range in {
+		if covering, ok := byName[s.ScenarioName]; !ok || !covering.Covers(s) {
+			out = append(out, s)
+		}
+	}
+	return types.SortByDate(out)
+}
+
+func reputationChanges(oldChar, newChar types.Character) []*ReputationChange {
+	keys := []string{}
+	for k := range oldChar.Prestige {
+		keys = append(keys, k)
+	}
+	for k := range newChar.Prestige {
+		if _, ok := oldChar.Prestige[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []*ReputationChange{}
+	for _, k := range keys {
+		if oldChar.Prestige[k] != newChar.Prestige[k] {
+			changes = append(changes, &ReputationChange{Character: newChar, Key: k, Old: oldChar.Prestige[k],
+				New: newChar.Prestige[k]})
+		}
+	}
+	return changes
+}
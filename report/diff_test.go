@@ -0,0 +1,118 @@
+package report
+
+import (
+	"github.com/pdbogen/autopfs/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func play(name string, d int, character int) *types.Session {
+	return &types.Session{Date: time.Date(2018, 1, d, 0, 0, 0, 0, time.UTC), ScenarioName: name,
+		EventNumber: []int64{int64(d)}, Character: []int{character}, Player: true}
+}
+
+func sessionNames(sessions []*types.Session) string {
+	ret := []string{}
+	for _, s := range sessions {
+		ret = append(ret, s.ScenarioName)
+	}
+	return strings.Join(ret, ", ")
+}
+
+func characterNames(characters []types.Character) string {
+	ret := []string{}
+	for _, c := range characters {
+		ret = append(ret, c.Name)
+	}
+	return strings.Join(ret, ", ")
+}
+
+func TestDiff(t *testing.T) {
+	valeros := types.Character{System: types.Pathfinder, Number: 1, Name: "Valeros",
+		Prestige: map[string]int{"Grand Lodge": 2}}
+	valerosLater := types.Character{System: types.Pathfinder, Number: 1, Name: "Valeros",
+		Prestige: map[string]int{"Grand Lodge": 4, "Fame": 4}}
+	seoni := types.Character{System: types.Pathfinder, Number: 2, Name: "Seoni"}
+	// Starfinder character 2 is not Pathfinder character 2.
+	navasi := types.Character{System: types.Starfinder, Number: 2, Name: "Navasi"}
+
+	a1, a2, b1 := play("A", 1, 1), play("A", 2, 2), play("B", 3, 1)
+	merged := types.DeDupe([]*types.Session{a1, a2})
+
+	cases := []struct {
+		Name                        string
+		A, B                        types.Job
+		Added, Removed              string
+		NewCharacters, RemovedChars string
+		Reputation                  []string
+	}{
+		{
+			Name: "nothing changed",
+			A:    types.Job{Plays: []*types.Session{a1}, Characters: []types.Character{valeros}},
+			B:    types.Job{Plays: []*types.Session{a1}, Characters: []types.Character{valeros}},
+		},
+		{
+			Name:    "plays added and removed",
+			A:       types.Job{Plays: []*types.Session{a1, a2}},
+			B:       types.Job{Plays: []*types.Session{b1, a1}},
+			Added:   "B",
+			Removed: "A",
+		},
+		{
+			Name: "merged sessions cover their plays",
+			A:    types.Job{Sessions: merged},
+			B:    types.Job{Plays: []*types.Session{a1, a2}},
+		},
+		{
+			Name:  "a merged session is added if any play is new",
+			A:     types.Job{Plays: []*types.Session{a1}},
+			B:     types.Job{Sessions: merged},
+			Added: "A",
+		},
+		{
+			Name:          "characters",
+			A:             types.Job{Characters: []types.Character{valeros, seoni}},
+			B:             types.Job{Characters: []types.Character{valerosLater, navasi}},
+			NewCharacters: "Navasi",
+			RemovedChars:  "Seoni",
+			Reputation:    []string{"Fame", "Grand Lodge"},
+		},
+		{
+			Name: "imported jobs have no characters",
+			A:    types.Job{Plays: []*types.Session{a1}},
+			B:    types.Job{Plays: []*types.Session{a1}, Characters: []types.Character{valeros, seoni}},
+		},
+		{
+			Name: "nor do jobs imported later",
+			A:    types.Job{Plays: []*types.Session{a1}, Characters: []types.Character{valeros, seoni}},
+			B:    types.Job{Plays: []*types.Session{a1}},
+		},
+	}
+	for _, tc := range cases {
+		diff := Diff(tc.A, tc.B)
+		if got := sessionNames(diff.Added); got != tc.Added {
+			t.Errorf("%s: added %q, want %q", tc.Name, got, tc.Added)
+		}
+		if got := sessionNames(diff.Removed); got != tc.Removed {
+			t.Errorf("%s: removed %q, want %q", tc.Name, got, tc.Removed)
+		}
+		if got := characterNames(diff.NewCharacters); got != tc.NewCharacters {
+			t.Errorf("%s: new characters %q, want %q", tc.Name, got, tc.NewCharacters)
+		}
+		if got := characterNames(diff.RemovedCharacters); got != tc.RemovedChars {
+			t.Errorf("%s: removed characters %q, want %q", tc.Name, got, tc.RemovedChars)
+		}
+		keys := []string{}
+		for _, change := range diff.Reputation {
+			keys = append(keys, change.Key)
+		}
+		if got, want := strings.Join(keys, ", "), strings.Join(tc.Reputation, ", "); got != want {
+			t.Errorf("%s: reputation changes %q, want %q", tc.Name, got, want)
+		}
+		if empty := tc.Added == "" && tc.Removed == "" && tc.NewCharacters == "" && tc.RemovedChars == "" &&
+			len(tc.Reputation) == 0; diff.Empty() != empty {
+			t.Errorf("%s: Empty() is %v, want %v", tc.Name, diff.Empty(), empty)
+		}
+	}
+}
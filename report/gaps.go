@@ -0,0 +1,102 @@
+// Package report builds summaries of a job's sessions.
+package report
+
+import (
+	"fmt"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+)
+
+// Gap statuses.
+const (
+	StatusUnplayed = "not played or GMed"
+	StatusNotGMed  = "played, not GMed"
+)
+
+// GapScenario is one scenario missing from a job, with its Code as usually written, e.g. 5-08 or #23. Name is often
+// empty; see paizo.CatalogSeason.
+type GapScenario struct {
+	Number int
+	Code   string
+	Name   string
+	Status string
+}
+
+// SeasonGaps lists, for one season of one game, the scenarios that have not been played or GMed, and separately
+// those that have been played but not GMed.
+type SeasonGaps struct {
+	Game     string
+	Type     string
+	Season   int
+	Total    int
+	Unplayed []*GapScenario
+	NotGMed  []*GapScenario
+}
+
+// Gaps compares the given plays against every season listed in the catalog. Seasons are returned in catalog order;
+// seasons with no gaps at all are included, with empty lists.
+func Gaps(plays []*types.Session, catalog *paizo.Catalog) []*SeasonGaps {
+	type key struct {
+		game, typ      string
+		season, number int
+	}
+	played := map[key]bool{}
+	gmed := map[key]bool{}
+	names := map[key]string{}
+	for _, play := range plays {
+		if play.Season < 0 {
+			continue
+		}
+		k := key{play.Game, seriesType(play.Type), play.Season, play.Number}
+		played[k] = played[k] || play.Player
+		gmed[k] = gmed[k] || play.GM
+		names[k] = play.ScenarioName
+	}
+
+	ret := []*SeasonGaps{}
+	for _, season := range catalog.Seasons {
+		gaps := &SeasonGaps{
+			Game:     season.Game,
+			Type:     season.Type,
+			Season:   season.Season,
+			Total:    season.Last - season.First + 1,
+			Unplayed: []*GapScenario{},
+			NotGMed:  []*GapScenario{},
+		}
+		for n := season.First; n <= season.Last; n++ {
+			k := key{season.Game, seriesType(season.Type), season.Season, n}
+			name := names[k]
+			if entry := catalog.Find(season.Game, season.Season, n); name == "" && entry != nil {
+				name = entry.Name
+			}
+			scen := &GapScenario{Number: n, Code: code(season, n), Name: name}
+			switch {
+			case !played[k] && !gmed[k]:
+				scen.Status = StatusUnplayed
+				gaps.Unplayed = append(gaps.Unplayed, scen)
+			case !gmed[k]:
+				scen.Status = StatusNotGMed
+				gaps.NotGMed = append(gaps.NotGMed, scen)
+			}
+		}
+		ret = append(ret, gaps)
+	}
+	return ret
+}
+
+func code(season *paizo.CatalogSeason, number int) string {
+	if season.Type == types.TypeQuest || season.Type == types.TypeBounty ||
+		(season.Game == "Pathfinder" && season.Season <= 1) {
+		return fmt.Sprintf("#%d", number)
+	}
+	return fmt.Sprintf("%d-%02d", season.Season, number)
+}
+
+// seriesType groups scenarios and specials, which share numbering within a season, apart from quests and bounties,
+// which are each numbered on their own.
+func seriesType(t string) string {
+	if t == types.TypeQuest || t == types.TypeBounty {
+		return t
+	}
+	return types.TypeScenario
+}
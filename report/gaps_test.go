@@ -0,0 +1,89 @@
+package report
+
+import (
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+	"strings"
+	"testing"
+)
+
+const testCatalogJson = `{"Version": 2,
+	"Scenarios": [
+		{"Name": "The Confirmation", "Game": "Pathfinder", "Season": 5, "Number": 8, "Type": "Scenario"}
+	],
+	"Seasons": [
+		{"Game": "Pathfinder", "Type": "Scenario", "Season": 0, "First": 1, "Last": 3},
+		{"Game": "Starfinder", "Type": "Scenario", "Season": 1, "First": 1, "Last": 2},
+		{"Game": "Pathfinder", "Type": "Scenario", "Season": 5, "First": 7, "Last": 9},
+		{"Game": "Pathfinder2", "Type": "Quest", "Season": 0, "First": 1, "Last": 2}
+	]}`
+
+func testCatalog(t *testing.T) *paizo.Catalog {
+	catalog, err := paizo.ParseCatalog(strings.NewReader(testCatalogJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+// codes returns the codes and names of the given scenarios, e.g. "5-08: The Confirmation".
+func codes(scens []*GapScenario) string {
+	ret := []string{}
+	for _, scen := range scens {
+		if scen.Name != "" {
+			ret = append(ret, scen.Code+": "+scen.Name)
+		} else {
+			ret = append(ret, scen.Code)
+		}
+	}
+	return strings.Join(ret, ", ")
+}
+
+func TestGaps(t *testing.T) {
+	plays := []*types.Session{
+		{Game: "Pathfinder", Season: 0, Number: 2, ScenarioName: "Mists of Mwangi", Type: types.TypeScenario,
+			Player: true},
+		{Game: "Pathfinder", Season: 0, Number: 3, ScenarioName: "Murder on the Throaty Mermaid",
+			Type: types.TypeScenario, GM: true},
+		{Game: "Pathfinder", Season: 5, Number: 7, ScenarioName: "The Traitor's Lodge", Type: types.TypeScenario,
+			Player: true},
+		{Game: "Pathfinder", Season: 5, Number: 7, ScenarioName: "The Traitor's Lodge", Type: types.TypeScenario,
+			GM: true},
+		// Bounty 1 is not Quest 1.
+		{Game: "Pathfinder2", Season: 0, Number: 1, ScenarioName: "The Whitefang Wyrm", Type: types.TypeBounty,
+			Player: true},
+		{Game: "Starfinder", Season: 1, Number: 1, ScenarioName: "The Commencement", Type: types.TypeScenario,
+			Player: true},
+		// Unnumbered sessions are ignored.
+		{Game: "Pathfinder", Season: -1, ScenarioName: "We Be Goblins!", Type: types.TypeModule, Player: true},
+	}
+
+	want := []struct {
+		Game, Type        string
+		Season, Total     int
+		Unplayed, NotGMed string
+	}{
+		{"Pathfinder", types.TypeScenario, 0, 3, "#1", "#2: Mists of Mwangi"},
+		{"Starfinder", types.TypeScenario, 1, 2, "1-02", "1-01: The Commencement"},
+		{"Pathfinder", types.TypeScenario, 5, 3, "5-08: The Confirmation, 5-09", ""},
+		{"Pathfinder2", types.TypeQuest, 0, 2, "#1, #2", ""},
+	}
+
+	got := Gaps(plays, testCatalog(t))
+	if len(got) != len(want) {
+		t.Fatalf("got %d seasons, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Game != w.Game || g.Type != w.Type || g.Season != w.Season || g.Total != w.Total {
+			t.Errorf("season %d: got %s %s %d of %d, want %s %s %d of %d", i, g.Game, g.Type, g.Season, g.Total,
+				w.Game, w.Type, w.Season, w.Total)
+		}
+		if unplayed := codes(g.Unplayed); unplayed != w.Unplayed {
+			t.Errorf("%s season %d: got unplayed %q, want %q", w.Game, w.Season, unplayed, w.Unplayed)
+		}
+		if notGMed := codes(g.NotGMed); notGMed != w.NotGMed {
+			t.Errorf("%s season %d: got not GMed %q, want %q", w.Game, w.Season, notGMed, w.NotGMed)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/op/go-logging"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/paizo/fixture"
+	"github.com/pdbogen/autopfs/types"
+	"os"
+	"strings"
+)
+
+// scrapeFlags are the flags shared by every command that needs a job's worth of data.
+type scrapeFlags struct {
+	email       *string
+	pass        *string
+	loglevel    *string
+	useFixture  *bool
+	catalogPath *string
+	jobPath     *string
+	governor    *paizo.Governor
+}
+
+func addScrapeFlags(fs *flag.FlagSet) *scrapeFlags {
+	governor := paizo.NewGovernor()
+	fs.Float64Var(&governor.RequestsPerSecond, "paizo-rps", governor.RequestsPerSecond,
+		"most requests per second to make to Paizo; 0 for no limit")
+	fs.IntVar(&governor.MaxRetries, "paizo-retries", governor.MaxRetries,
+		"times to retry a Paizo request that fails with HTTP 429 or 5xx or a network error")
+	return &scrapeFlags{
+		governor: governor,
+		email:    fs.String("email", "", "address to use for paizo sign in"),
+		pass:     fs.String("password", "", "password to use for paizo sign in"),
+		loglevel: fs.String("loglevel", "info", "set to DEBUG for more logging, or INFO or ERROR for less"),
+		useFixture: fs.Bool("fixture", false, "scrape a local server of recorded Paizo pages instead of paizo.com; "+
+			"email and password default to the fixture's"),
+		catalogPath: fs.String("catalog", "", "path to a JSON scenario catalog to use instead of the built-in one"),
+		jobPath: fs.String("job", "", "read a job saved from the server's /json page, or a .csv export, instead "+
+			"of signing in to Paizo"),
+	}
+}
+
+// setup applies the log level and catalog flags. It should be called after the flags are parsed.
+func (f *scrapeFlags) setup() {
+	lvl, err := logging.LogLevel(*f.loglevel)
+	if err != nil {
+		log.Fatalf("could not parse log level %q: %s", *f.loglevel, err)
+	}
+	logging.SetLevel(lvl, log.Module)
+
+	if *f.catalogPath != "" {
+		cat, err := paizo.LoadCatalog(*f.catalogPath)
+		if err != nil {
+			log.Fatalf("loading scenario catalog: %s", err)
+		}
+		paizo.SetCatalog(cat)
+	}
+}
+
+// job returns the job named by -job, or else signs in to Paizo and retrieves characters and (unless charactersOnly)
+// sessions. Any fatal error exits the program.
+func (f *scrapeFlags) job(charactersOnly bool) *types.Job {
+	if *f.jobPath != "" {
+		return loadJobFile(*f.jobPath)
+	}
+
+	opts := paizo.Options{Governor: f.governor, Notify: func(msg string) { log.Info(msg) }}
+	if *f.useFixture {
+		srv := fixture.NewServer()
+		defer srv.Close()
+		opts.BaseUrl, opts.SecureUrl = srv.URL, srv.URL
+		if *f.email == "" && *f.pass == "" {
+			*f.email, *f.pass = fixture.Email, fixture.Password
+		}
+		log.Infof("Using fixture server at %s", srv.URL)
+	}
+
+	ctx := context.Background()
+	log.Debug("Logging in...")
+	pzo, err := paizo.LoginWith(ctx, opts, *f.email, *f.pass)
+	if err != nil {
+		log.Fatalf("during login: %s", err)
+	}
+	log.Debug("Login OK!")
+
+	log.Debug("Retrieving characters...")
+	characters, err := pzo.GetCharacters(ctx)
+	if err != nil {
+		log.Fatalf("retrieving characters: %s", err)
+	}
+	for i, c := range characters {
+		log.Infof("Character %d: %s", i, c)
+	}
+	job := &types.Job{Characters: characters}
+	if charactersOnly {
+		return job
+	}
+
+	log.Debug("Retrieving sessions...")
+	psessions, gsessions, err := pzo.GetSessions(ctx, characters, func(cur, total int) {
+		log.Debugf("%d/%d", cur, total)
+	})
+	if err != nil {
+		if psessions == nil {
+			log.Fatalf("retrieving sessions: %s", err)
+		} else {
+			log.Errorf("retrieving sessions: %s", err)
+		}
+	}
+	log.Infof("got %d player sessions, %d gm sessions", len(psessions), len(gsessions))
+
+	job.Plays = types.SortByDate(append(psessions, gsessions...))
+	job.Sessions = types.DeDupe(append(psessions, gsessions...))
+	return job
+}
+
+func loadJobFile(path string) *types.Job {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("opening job file: %s", err)
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		sessions, err := paizo.ReadCsv(f)
+		if err != nil {
+			log.Fatalf("parsing CSV file %q: %s", path, err)
+		}
+		return types.JobFromSessions(sessions)
+	}
+
+	job := &types.Job{}
+	if err := json.NewDecoder(f).Decode(job); err != nil {
+		log.Fatalf("parsing job file %q: %s", path, err)
+	}
+	return job
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// User is an account that remembers the jobs started while signed in to it, stored by normalized email address.
+type User struct {
+	Email string
+	// PasswordHash is the bcrypt hash of the user's password, or nil if they sign in only by emailed links.
+	PasswordHash []byte `json:",omitempty"`
+	Created      time.Time
+	// Jobs are the IDs of the user's jobs, oldest first, stored as SealedJobs.
+	Jobs       []string `json:",omitempty"`
+	SealedJobs []byte   `json:",omitempty"`
+}
+
+// marshalUser returns the JSON with which to store the user, sealing its jobs with credentialsKey.
+func marshalUser(user *User) ([]byte, error) {
+	stored := *user
+	if len(user.Jobs) > 0 {
+		if credentialsKey == nil {
+			return nil, errors.New("no credentials key is configured to seal the user's jobs")
+		}
+		jobsJson, err := json.Marshal(user.Jobs)
+		if err != nil {
+			return nil, err
+		}
+		if stored.SealedJobs, err = seal(credentialsKey, jobsJson); err != nil {
+			return nil, fmt.Errorf("sealing jobs: %v", err)
+		}
+		stored.Jobs = nil
+	}
+	return json.Marshal(stored)
+}
+
+// unmarshalUser reverses marshalUser.
+func unmarshalUser(userJson []byte, user *User) error {
+	if err := json.Unmarshal(userJson, user); err != nil {
+		return err
+	}
+	if user.SealedJobs == nil {
+		return nil
+	}
+	if credentialsKey == nil {
+		return errors.New("the user's jobs are sealed, but no credentials key is configured")
+	}
+	jobsJson, err := unseal(credentialsKey, user.SealedJobs)
+	if err != nil {
+		return fmt.Errorf("unsealing jobs: %v", err)
+	}
+	user.SealedJobs = nil
+	return json.Unmarshal(jobsJson, &user.Jobs)
+}
+
+// A login is a signed-in browser or an emailed sign-in link, stored by the hash of its token.
+type login struct {
+	Email   string
+	Expires time.Time
+	// PasswordHash is the password chosen for a new account, which is created when the link is used.
+	PasswordHash []byte `json:",omitempty"`
+}
+
+const (
+	loginCookie   = "login"
+	loginDuration = 30 * 24 * time.Hour
+	linkDuration  = 15 * time.Minute
+	minPassword   = 8
+)
+
+// linkExpiry describes linkDuration in emails and notices.
+var linkExpiry = fmt.Sprintf("%.0f minutes", linkDuration.Minutes())
+
+var errBadPassword = errors.New("incorrect email address or password")
+
+// errTooManyLogins is returned by CheckPassword when an address has failed to sign in too often.
+var errTooManyLogins = errors.New("too many failed sign-ins")
+
+const (
+	maxFailedLogins   = 5
+	failedLoginWindow = 15 * time.Minute
+)
+
+// loginThrottle counts the recent failed sign-ins for each email address, with or without an account.
+type loginThrottle struct {
+	mu sync.Mutex
+	// failures are the times of each address's failed sign-ins in the last failedLoginWindow, oldest first.
+	failures map[string][]time.Time
+}
+
+var failedLogins = &loginThrottle{failures: map[string][]time.Time{}}
+
+// recent returns the times of the address's failed sign-ins in the window before now; t.mu must be held.
+func (t *loginThrottle) recent(email string, now time.Time) []time.Time {
+	failures := t.failures[email]
+	for len(failures) > 0 && now.Sub(failures[0]) > failedLoginWindow {
+		failures = failures[1:]
+	}
+	if len(failures) == 0 {
+		delete(t.failures, email)
+		return nil
+	}
+	t.failures[email] = failures
+	return failures
+}
+
+// allowed returns true if the address may try to sign in now.
+func (t *loginThrottle) allowed(email string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.recent(email, now)) < maxFailedLogins
+}
+
+// fail records a failed sign-in for the address.
+func (t *loginThrottle) fail(email string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures[email] = append(t.recent(email, now), now)
+	// Forget addresses that have not failed lately.
+	if len(t.failures) > 1000 {
+		for other := range t.failures {
+			t.recent(other, now)
+		}
+	}
+}
+
+// reset forgets the address's failed sign-ins, once it has signed in.
+func (t *loginThrottle) reset(email string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, email)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoadUser returns the user with the given email address, or nil if there is none.
+func LoadUser(store Store, email string) (*User, error) {
+	user, err := store.LoadUser(normalizeEmail(email))
+	if err != nil {
+		return nil, fmt.Errorf("loading user %q: %v", email, err)
+	}
+	return user, nil
+}
+
+// updateUser loads or creates the user, calls update, and saves the user in one transaction unless update fails.
+func updateUser(store Store, email string, create bool, update func(*User) error) (*User, error) {
+	return store.UpdateUser(normalizeEmail(email), create, update)
+}
+
+// hashPassword checks that the password is long enough, and returns its bcrypt hash.
+func hashPassword(password string) ([]byte, error) {
+	if len(password) < minPassword {
+		return nil, fmt.Errorf("passwords must be at least %d characters", minPassword)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %v", err)
+	}
+	return hash, nil
+}
+
+// SetPassword sets the user's password.
+func (u *User) SetPassword(store Store, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	updated, err := updateUser(store, u.Email, false, func(user *User) error {
+		user.PasswordHash = hash
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("setting password for user %q: %v", u.Email, err)
+	}
+	*u = *updated
+	return nil
+}
+
+// CheckPassword returns the user if the password is theirs, errBadPassword if not, or errTooManyLogins.
+func CheckPassword(store Store, email, password string) (*User, error) {
+	normalized := normalizeEmail(email)
+	if !failedLogins.allowed(normalized, time.Now()) {
+		return nil, errTooManyLogins
+	}
+	user, err := LoadUser(store, email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.PasswordHash == nil ||
+		bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)) != nil {
+		failedLogins.fail(normalized, time.Now())
+		return nil, errBadPassword
+	}
+	failedLogins.reset(normalized)
+	return user, nil
+}
+
+// AddJob adds the job to the user's jobs.
+func (u *User) AddJob(store Store, jobId string) error {
+	updated, err := updateUser(store, u.Email, false, func(user *User) error {
+		for _, id := range user.Jobs {
+			if id == jobId {
+				return nil
+			}
+		}
+		user.Jobs = append(user.Jobs, jobId)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("adding job %q to user %q: %v", jobId, u.Email, err)
+	}
+	*u = *updated
+	return nil
+}
+
+// RemoveJobs removes the given jobs from the user's jobs; e.g., because they were deleted.
+func (u *User) RemoveJobs(store Store, jobIds []string) error {
+	remove := map[string]bool{}
+	for _, id := range jobIds {
+		remove[id] = true
+	}
+	updated, err := updateUser(store, u.Email, false, func(user *User) error {
+		jobs := []string{}
+		for _, id := range user.Jobs {
+			if !remove[id] {
+				jobs = append(jobs, id)
+			}
+		}
+		user.Jobs = jobs
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("removing jobs from user %q: %v", u.Email, err)
+	}
+	*u = *updated
+	return nil
+}
+
+// newToken returns a new random token for a login, link, or csrfToken.
+func newToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("generating token: %v", err)
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// newLogin saves a new login of the given kind, "logins" or "links", and returns its token.
+func newLogin(store Store, kind string, l login, duration time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	l.Email, l.Expires = normalizeEmail(l.Email), time.Now().Add(duration)
+	if err := store.SaveLogin(kind, hashToken(token), l); err != nil {
+		return "", fmt.Errorf("saving %s: %v", kind, err)
+	}
+	return token, nil
+}
+
+// findLogin returns the unexpired login of the given kind with the token, or nil, removing it if consume is true.
+func findLogin(store Store, kind, token string, consume bool) (*login, error) {
+	if token == "" {
+		return nil, nil
+	}
+	l, err := store.FindLogin(kind, hashToken(token), consume)
+	if err != nil {
+		return nil, fmt.Errorf("finding %s: %v", kind, err)
+	}
+	if l == nil || !time.Now().Before(l.Expires) {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// PruneLogins removes expired logins and links.
+func PruneLogins(store Store) error {
+	return store.PruneLogins(time.Now())
+}
+
+// sendLink emails a sign-in link to the address, which confirms a new account if passwordHash is non-nil.
+func sendLink(store Store, mailer Mailer, baseUrl, email string, passwordHash []byte) error {
+	token, err := newLogin(store, "links", login{Email: email, PasswordHash: passwordHash}, linkDuration)
+	if err != nil {
+		return err
+	}
+	link := strings.TrimRight(baseUrl, "/") + "/account?token=" + token
+	subject, body := "Sign in to AutoPFS", "To sign in to AutoPFS, follow this link within "+
+		linkExpiry+":\n\n"+link+"\n\nIf you did not ask to sign in, you can ignore this email.\n"
+	if passwordHash != nil {
+		subject, body = "Confirm your AutoPFS account", "To confirm your new AutoPFS account and sign in, follow "+
+			"this link within "+linkExpiry+":\n\n"+link+"\n\nIf you did not sign up, you can ignore "+
+			"this email.\n"
+	}
+	return mailer.Send(normalizeEmail(email), subject, body)
+}
+
+// useLink consumes the sign-in link and returns its user, creating it if needed, or nil if there is no such link.
+func useLink(store Store, token string) (*User, error) {
+	l, err := findLogin(store, "links", token, true)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	return updateUser(store, l.Email, true, func(user *User) error {
+		// An existing password is changed only when signed in; see SetPassword.
+		if user.PasswordHash == nil {
+			user.PasswordHash = l.PasswordHash
+		}
+		return nil
+	})
+}
+
+// signIn starts a login for the user, and sets the browser's login cookie.
+func signIn(store Store, rw http.ResponseWriter, req *http.Request, user *User) error {
+	token, err := newLogin(store, "logins", login{Email: user.Email}, loginDuration)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(rw, &http.Cookie{
+		Name:     loginCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(loginDuration),
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// signOut ends the browser's login, if it has one.
+func signOut(store Store, rw http.ResponseWriter, req *http.Request) error {
+	http.SetCookie(rw, &http.Cookie{Name: loginCookie, Path: "/", MaxAge: -1})
+	cookie, _ := req.Cookie(loginCookie)
+	if cookie == nil {
+		return nil
+	}
+	_, err := findLogin(store, "logins", cookie.Value, true)
+	return err
+}
+
+// currentUser returns the user that the browser is signed in as, or nil if it is not signed in.
+func currentUser(store Store, req *http.Request) (*User, error) {
+	cookie, _ := req.Cookie(loginCookie)
+	if cookie == nil {
+		return nil, nil
+	}
+	l, err := findLogin(store, "logins", cookie.Value, false)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	return LoadUser(store, l.Email)
+}
+
+const csrfCookie = "csrf"
+
+// csrfToken returns the token in the browser's csrf cookie, setting the cookie if there is none.
+func csrfToken(rw http.ResponseWriter, req *http.Request) (string, error) {
+	if cookie, _ := req.Cookie(csrfCookie); cookie != nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(rw, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/account",
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// checkCsrf returns true if the request was posted with the token in the browser's csrf cookie.
+func checkCsrf(req *http.Request) bool {
+	cookie, _ := req.Cookie(csrfCookie)
+	return cookie != nil && cookie.Value != "" && hmac.Equal([]byte(cookie.Value), []byte(req.PostFormValue("csrf")))
+}
+
+// mergeHistory adds the jobs remembered by the browser's history cookie to the user's jobs, and clears the cookie.
+func mergeHistory(store Store, rw http.ResponseWriter, req *http.Request, user *User) (int, error) {
+	history := historyCookie(req)
+	for _, id := range history {
+		if err := user.AddJob(store, id); err != nil {
+			return 0, err
+		}
+	}
+	http.SetCookie(rw, &http.Cookie{Name: historyCookieName, Path: "/", MaxAge: -1})
+	return len(history), nil
+}
+
+const historyCookieName = "history"
+
+// historyCookie returns the IDs of the jobs remembered by the browser while signed out.
+func historyCookie(req *http.Request) []string {
+	cookie, _ := req.Cookie(historyCookieName)
+	if cookie == nil || cookie.Value == "" {
+		return nil
+	}
+	return strings.Split(cookie.Value, ",")
+}
+
+func setHistoryCookie(rw http.ResponseWriter, jobIds []string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:    historyCookieName,
+		Value:   strings.Join(jobIds, ","),
+		Path:    "/",
+		Expires: time.Now().Add(365 * 24 * time.Hour),
+	})
+}
+
+// rememberJob adds the job to the signed-in user's jobs; or, if the browser is not signed in, to its history cookie.
+func rememberJob(store Store, rw http.ResponseWriter, req *http.Request, jobId string) {
+	user, err := currentUser(store, req)
+	if err != nil {
+		log.Errorf("finding signed-in user: %v", err)
+	}
+	if user != nil {
+		if err := user.AddJob(store, jobId); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+	setHistoryCookie(rw, append(historyCookie(req), jobId))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := &loginThrottle{failures: map[string][]time.Time{}}
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < maxFailedLogins; i++ {
+		if !throttle.allowed("a@example.com", now) {
+			t.Fatalf("throttled after %d failures", i)
+		}
+		throttle.fail("a@example.com", now.Add(time.Duration(i)*time.Minute))
+	}
+	if throttle.allowed("a@example.com", now.Add(maxFailedLogins*time.Minute)) {
+		t.Errorf("not throttled after %d failures", maxFailedLogins)
+	}
+	if !throttle.allowed("b@example.com", now) {
+		t.Error("another address was throttled")
+	}
+
+	// Once the first failure is old enough, another try is allowed, but only one.
+	later := now.Add(failedLoginWindow + time.Second)
+	if !throttle.allowed("a@example.com", later) {
+		t.Error("still throttled after the first failure expired")
+	}
+	throttle.fail("a@example.com", later)
+	if throttle.allowed("a@example.com", later) {
+		t.Error("not throttled after failing again")
+	}
+
+	throttle.reset("a@example.com")
+	if !throttle.allowed("a@example.com", later) {
+		t.Error("still throttled after signing in")
+	}
+}
+
+func TestCheckPasswordThrottled(t *testing.T) {
+	store, done := testBoltStore(t)
+	defer done()
+	defer failedLogins.reset("throttled@example.com")
+
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = updateUser(store, "throttled@example.com", true, func(user *User) error {
+		user.PasswordHash = hash
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxFailedLogins; i++ {
+		if _, err := CheckPassword(store, "throttled@example.com", "wrong"); err != errBadPassword {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, errBadPassword)
+		}
+	}
+	// Even the right password is refused, and the address's case does not matter.
+	if _, err := CheckPassword(store, "Throttled@Example.com", "correct horse"); err != errTooManyLogins {
+		t.Errorf("got %v, want %v", err, errTooManyLogins)
+	}
+}
+
+func TestMarshalUser(t *testing.T) {
+	defer withCredentialsKey(bytes.Repeat([]byte{7}, 32))()
+
+	user := &User{Email: "a@example.com", Jobs: []string{"first-job", "second-job"}}
+	userJson, err := marshalUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(userJson, []byte("first-job")) {
+		t.Error("stored user contains a job ID")
+	}
+	got := &User{}
+	if err := unmarshalUser(userJson, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Jobs) != 2 || got.Jobs[0] != "first-job" || got.Jobs[1] != "second-job" || got.SealedJobs != nil {
+		t.Errorf("got jobs %q, sealed %v", got.Jobs, got.SealedJobs)
+	}
+
+	withCredentialsKey(nil)
+	if _, err := marshalUser(user); err == nil {
+		t.Error("stored jobs without a key")
+	}
+	if err := unmarshalUser(userJson, &User{}); err == nil {
+		t.Error("read sealed jobs without a key")
+	}
+	// Users without jobs need no key.
+	if _, err := marshalUser(&User{Email: "b@example.com"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAccountLink(t *testing.T) {
+	store, done := testBoltStore(t)
+	defer done()
+	account := Account(store, logMailer{}, "", "", "")
+
+	token, err := newLogin(store, "links", login{Email: "linked@example.com"}, linkDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Following the link asks to confirm it, and does not use it up.
+	rec := httptest.NewRecorder()
+	account(rec, httptest.NewRequest(http.MethodGet, "/account?token="+token, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Sign in as linked@example.com") {
+		t.Fatalf("following link: %d %s", rec.Code, rec.Body)
+	}
+	if l, err := findLogin(store, "links", token, false); err != nil || l == nil {
+		t.Fatalf("link was used by following it: %v, %v", l, err)
+	}
+	var csrf *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == csrfCookie {
+			csrf = cookie
+		}
+	}
+	if csrf == nil {
+		t.Fatal("no csrf cookie")
+	}
+
+	post := func(form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/account", strings.NewReader(form.Encode()))
+		req.Header.Set("content-type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		account(rec, req)
+		return rec
+	}
+
+	// Another site can post the form, but without the token in the browser's cookie.
+	form := url.Values{"action": {"uselink"}, "token": {token}, "csrf": {"guess"}}
+	if rec := post(form, csrf); rec.Code != http.StatusForbidden {
+		t.Errorf("posted with the wrong csrf token: %d", rec.Code)
+	}
+	form.Set("csrf", csrf.Value)
+	if rec := post(form); rec.Code != http.StatusForbidden {
+		t.Errorf("posted without the csrf cookie: %d", rec.Code)
+	}
+	loginForm := url.Values{"action": {"login"}, "email": {"linked@example.com"}, "password": {"anything"}}
+	if rec := post(loginForm); rec.Code != http.StatusForbidden {
+		t.Errorf("signed in without a csrf token: %d", rec.Code)
+	}
+
+	rec = post(form, csrf)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("using link: %d %s", rec.Code, rec.Body)
+	}
+	signedIn := false
+	for _, cookie := range rec.Result().Cookies() {
+		signedIn = signedIn || cookie.Name == loginCookie && cookie.Value != ""
+	}
+	if !signedIn {
+		t.Error("using link did not sign in")
+	}
+	if rec := post(form, csrf); rec.Code != http.StatusNotFound {
+		t.Errorf("used link twice: %d", rec.Code)
+	}
+}
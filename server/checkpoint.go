@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pdbogen/autopfs/types"
+	"io/ioutil"
+	"os"
+)
+
+// Checkpoint records enough of a running job's progress to continue it if the server is restarted.
+type Checkpoint struct {
+	// Refresh is true if the job was being refreshed, rather than run for the first time.
+	Refresh bool
+	// Credentials are the job's Paizo email and password, sealed with credentialsKey.
+	Credentials []byte
+	// PageUrl is the next page of All Sessions to read, or empty if no sessions have been read yet.
+	PageUrl string
+	// Player and GM are the sessions read before PageUrl.
+	Player []*types.Session
+	GM     []*types.Session
+	// Import, if non-nil, is uploaded data to read instead of Paizo; see importSource.
+	Import *types.Job `json:",omitempty"`
+}
+
+// credentialsKey seals credentials and job IDs; it is nil only in `db` commands run without a key.
+var credentialsKey []byte
+
+// sealCheckpoint returns the envelope in which to store the checkpoint of the job with the given ID.
+func sealCheckpoint(jobId string, cp *Checkpoint) ([]byte, error) {
+	jsonBytes, err := json.Marshal(cp)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling checkpoint to JSON: %v", err)
+	}
+
+	env, err := sealRecord(jobId, jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error sealing checkpoint: %v", err)
+	}
+	stored, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling checkpoint envelope to JSON: %v", err)
+	}
+	return stored, nil
+}
+
+// openCheckpoint reverses sealCheckpoint.
+func openCheckpoint(jobId string, stored []byte) (*Checkpoint, error) {
+	cpJson, err := openRecord(jobId, stored)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(cpJson, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// loadCredentialsKey reads the key at path, creating it if it does not exist.
+func loadCredentialsKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generating key: %v", err)
+		}
+		if err := ioutil.WriteFile(path, key, os.FileMode(0600)); err != nil {
+			return nil, fmt.Errorf("writing new key to %q: %v", path, err)
+		}
+		log.Infof("Created new credentials key %q", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading key %q: %v", path, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key %q should be 32 bytes, but is %d", path, len(key))
+	}
+	return key, nil
+}
+
+type credentials struct {
+	Email string
+	Pass  string
+}
+
+// sealCredentials encrypts the given email and password with credentialsKey.
+func sealCredentials(email, pass string) ([]byte, error) {
+	if credentialsKey == nil {
+		return nil, errors.New("no credentials key is configured")
+	}
+	plain, err := json.Marshal(credentials{email, pass})
+	if err != nil {
+		return nil, err
+	}
+	return seal(credentialsKey, plain)
+}
+
+// unsealCredentials reverses sealCredentials.
+func unsealCredentials(sealed []byte) (email, pass string, err error) {
+	if credentialsKey == nil {
+		return "", "", errors.New("no credentials key is configured")
+	}
+	plain, err := unseal(credentialsKey, sealed)
+	if err != nil {
+		return "", "", fmt.Errorf("unsealing credentials: %v", err)
+	}
+	creds := credentials{}
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return "", "", fmt.Errorf("parsing unsealed credentials: %v", err)
+	}
+	return creds.Email, creds.Pass, nil
+}
+
+// ResumeOrphans queues the unfinished jobs of a previous server process that have checkpoints, and fails the rest.
+func ResumeOrphans(store Store, queue *Queue) error {
+	summaries, err := store.ListJobs()
+	if err != nil {
+		return fmt.Errorf("finding unfinished jobs: %v", err)
+	}
+	jobIds := []string{}
+	for _, summary := range summaries {
+		if !summary.Finished && summary.Id != "" {
+			jobIds = append(jobIds, summary.Id)
+		}
+	}
+
+	jobs, err := LoadMany(store, jobIds)
+	if err != nil {
+		return fmt.Errorf("loading unfinished jobs: %v", err)
+	}
+
+	for _, job := range jobs {
+		cp, err := store.LoadCheckpoint(job.JobId)
+		if err != nil {
+			log.Warningf("loading checkpoint for job %q: %v", job.JobId, err)
+		}
+		if cp != nil && (cp.Credentials != nil || cp.Import != nil) {
+			if cp.Import == nil {
+				job.Email, job.Pass, err = unsealCredentials(cp.Credentials)
+			}
+			if err == nil {
+				var existingId string
+				existingId, err = queue.Add(job, cp)
+				if err == nil && existingId == "" {
+					log.Infof("Resuming job %q", job.JobId)
+					continue
+				}
+				if err == nil {
+					err = fmt.Errorf("job %q for the same account is already queued", existingId)
+				}
+			}
+			log.Warningf("cannot resume job %q: %v", job.JobId, err)
+		}
+
+		log.Infof("Abandoning unfinished job %q", job.JobId)
+		msg := "This job was interrupted by a server restart and could not be resumed. Please start again."
+		if err := job.UpdateStatus(store, types.JobStateError, msg); err != nil {
+			log.Error(err)
+		}
+		if (cp != nil && cp.Refresh) || job.Sessions != nil {
+			if err := job.UpdateStatus(store, types.JobStateDone, "Refresh failed; keeping the previous results."); err != nil {
+				log.Error(err)
+			}
+		}
+		job.clearCheckpoint(store)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var msgShortPassword = fmt.Sprintf("Sorry, passwords must be at least %d characters.", minPassword)
+
+const msgLinkExpired = "Sorry, that link has expired or was already used. Go back and ask for another?"
+
+var msgTooManyLogins = fmt.Sprintf("Sorry, there have been too many failed attempts to sign in to that account. "+
+	"Please wait %.0f minutes, or ask for a link to sign in without a password.", failedLoginWindow.Minutes())
+
+// Account shows the signed-in user's jobs or the sign-in forms, and handles the forms' actions: login, signup, link,
+// uselink, password, history, and logout.
+func Account(store Store, mailer Mailer, baseUrl, JsHash, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		page := map[string]interface{}{
+			"Title":   "Account",
+			"JsHash":  JsHash,
+			"CssHash": CssHash,
+		}
+		status := http.StatusOK
+
+		user, err := currentUser(store, req)
+		if err != nil {
+			log.Errorf("finding signed-in user: %v", err)
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		csrf, err := csrfToken(rw, req)
+		if err != nil {
+			log.Errorf("making csrf token: %v", err)
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		page["Csrf"] = csrf
+
+		if token := req.URL.Query().Get("token"); token != "" && req.Method == http.MethodGet {
+			link, err := findLogin(store, "links", token, false)
+			if err != nil {
+				log.Errorf("finding sign-in link: %v", err)
+				http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+				return
+			}
+			if link == nil {
+				http.Error(rw, msgLinkExpired, http.StatusNotFound)
+				return
+			}
+			page["Confirm"] = link.Email
+			page["Token"] = token
+		}
+
+		history := historyCookie(req)
+		if req.Method == http.MethodPost {
+			email, password := req.PostFormValue("email"), req.PostFormValue("password")
+			action := req.PostFormValue("action")
+			if !checkCsrf(req) {
+				http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?",
+					http.StatusForbidden)
+				return
+			}
+			switch action {
+			case "password", "history":
+				if user == nil {
+					http.Error(rw, "Sorry, you need to sign in first.", http.StatusForbidden)
+					return
+				}
+			}
+			switch action {
+			case "login":
+				user, err := CheckPassword(store, email, password)
+				if err == errBadPassword {
+					page["Error"] = "Sorry, that email address and password don't match an account."
+					status = http.StatusUnauthorized
+					break
+				}
+				if err == errTooManyLogins {
+					page["Error"] = msgTooManyLogins
+					status = http.StatusTooManyRequests
+					break
+				}
+				if err == nil {
+					err = signIn(store, rw, req, user)
+				}
+				if err != nil {
+					log.Errorf("signing in %q: %v", email, err)
+					http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+					return
+				}
+				http.Redirect(rw, req, "/account", http.StatusFound)
+				return
+			case "uselink":
+				linked, err := useLink(store, req.PostFormValue("token"))
+				if err != nil {
+					log.Errorf("using sign-in link: %v", err)
+					http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+					return
+				}
+				if linked == nil {
+					http.Error(rw, msgLinkExpired, http.StatusNotFound)
+					return
+				}
+				if err := signIn(store, rw, req, linked); err != nil {
+					log.Errorf("signing in %q: %v", linked.Email, err)
+					http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+					return
+				}
+				http.Redirect(rw, req, "/account", http.StatusFound)
+				return
+			case "signup", "link":
+				if !strings.Contains(email, "@") {
+					page["Error"] = "Sorry, an email address is required."
+					status = http.StatusBadRequest
+					break
+				}
+				signUp := req.PostFormValue("action") == "signup"
+				if signUp && len(password) < minPassword {
+					page["Error"] = msgShortPassword
+					status = http.StatusBadRequest
+					break
+				}
+				var hash []byte
+				if signUp {
+					hash, err = hashPassword(password)
+				}
+				// An existing account gets a plain sign-in link, and the same response.
+				var existing *User
+				if err == nil {
+					existing, err = LoadUser(store, email)
+				}
+				if existing != nil {
+					hash = nil
+				}
+				if err == nil {
+					err = sendLink(store, mailer, baseUrl, email, hash)
+				}
+				if err != nil {
+					log.Errorf("sending sign-in link to %q: %v", email, err)
+					http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+					return
+				}
+				page["Notice"] = "Check your email for a link to sign in; it expires in " + linkExpiry + "."
+			case "password":
+				if len(password) < minPassword {
+					page["Error"] = msgShortPassword
+					status = http.StatusBadRequest
+					break
+				}
+				if err := user.SetPassword(store, password); err != nil {
+					log.Error(err)
+					http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+					return
+				}
+				page["Notice"] = "Your password has been set."
+			case "history":
+				added, err := mergeHistory(store, rw, req, user)
+				if err != nil {
+					log.Error(err)
+					http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+					return
+				}
+				history = nil
+				page["Notice"] = fmt.Sprintf("Added %d retrievals to your account.", added)
+			case "logout":
+				if err := signOut(store, rw, req); err != nil {
+					log.Errorf("signing out: %v", err)
+				}
+				http.Redirect(rw, req, "/", http.StatusFound)
+				return
+			default:
+				http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?",
+					http.StatusBadRequest)
+				return
+			}
+		}
+
+		if user != nil {
+			page["User"] = user
+			page["Jobs"] = userJobs(store, user)
+			page["History"] = len(history)
+		}
+
+		rw.Header().Add("content-type", "text/html")
+		rw.WriteHeader(status)
+		if err := TemplateRoot.ExecuteTemplate(rw, "account", page); err != nil {
+			log.Errorf("rendering account template: %v", err)
+		}
+	}
+}
+
+// userJobs loads the user's jobs, newest first, forgetting any that no longer exist.
+func userJobs(store Store, user *User) []*Job {
+	jobs, err := LoadMany(store, user.Jobs)
+	if err != nil {
+		log.Errorf("loading jobs of user %q: %v", user.Email, err)
+		return nil
+	}
+	if missing := missingJobs(user.Jobs, jobs); len(missing) > 0 {
+		if err := user.RemoveJobs(store, missing); err != nil {
+			log.Error(err)
+		}
+	}
+	return newestFirst(jobs)
+}
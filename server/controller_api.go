@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/pdbogen/autopfs/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPrefix is the path of version 1 of the JSON API; see assets/api/openapi.json.
+const apiPrefix = "/api/v1/"
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// apiError is the body of every unsuccessful API response.
+type apiError struct {
+	Error string
+}
+
+// apiJob is a job's status, as returned by the API.
+type apiJob struct {
+	Id         string
+	State      string
+	Done       bool
+	Finished   bool
+	JobDate    time.Time
+	Sessions   int
+	Plays      int
+	Characters int
+	// Message is the job's latest message.
+	Message *types.JobMessage `json:",omitempty"`
+}
+
+// apiSessions is a page of a job's sessions.
+type apiSessions struct {
+	Total    int
+	Offset   int
+	Limit    int
+	Sessions []*types.Session
+}
+
+func newApiJob(job *Job) apiJob {
+	ret := apiJob{
+		Id:         job.JobId,
+		State:      job.State,
+		Done:       job.Done(),
+		Finished:   job.Finished(),
+		JobDate:    job.JobDate,
+		Sessions:   len(job.Sessions),
+		Plays:      len(job.Plays),
+		Characters: len(job.Characters),
+	}
+	if len(job.Messages) > 0 {
+		ret.Message = job.Messages[len(job.Messages)-1]
+	}
+	return ret
+}
+
+// API serves the JSON API:
+//
+//	POST   /api/v1/jobs                 start a job, given an email and password
+//	GET    /api/v1/jobs/ID              get a job's status
+//	DELETE /api/v1/jobs/ID              delete a finished job
+//	GET    /api/v1/jobs/ID/sessions     list a job's sessions, optionally filtered, a page at a time
+//	GET    /api/v1/jobs/ID/characters   list a job's characters
+//	GET    /api/v1/jobs/ID/messages     list a job's messages
+//	GET    /api/v1/openapi.json         describe all of the above
+func API(store Store, queue *Queue) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		path := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, apiPrefix), "/"), "/")
+
+		switch {
+		case len(path) == 1 && path[0] == "openapi.json":
+			apiOpenAPI(rw, req)
+		case len(path) == 1 && path[0] == "jobs":
+			if !apiMethod(rw, req, http.MethodPost) {
+				return
+			}
+			apiCreateJob(queue, rw, req)
+		case len(path) == 2 && path[0] == "jobs":
+			if !apiMethod(rw, req, http.MethodGet, http.MethodDelete) {
+				return
+			}
+			fallthrough
+		case len(path) == 3 && path[0] == "jobs":
+			if len(path) == 3 && !apiMethod(rw, req, http.MethodGet) {
+				return
+			}
+			job, err := Load(store, path[1])
+			if err != nil {
+				log.Errorf("retrieving job %q from DB: %v", path[1], err)
+				apiRespond(rw, http.StatusInternalServerError, apiError{Error: "internal server error"})
+				return
+			}
+			if job == nil {
+				apiRespond(rw, http.StatusNotFound, apiError{Error: "no such job"})
+				return
+			}
+			if len(path) == 2 && req.Method == http.MethodDelete {
+				apiDeleteJob(store, job, rw)
+				return
+			}
+			if len(path) == 2 {
+				apiRespond(rw, http.StatusOK, newApiJob(job))
+				return
+			}
+			switch path[2] {
+			case "sessions":
+				apiListSessions(job, rw, req)
+			case "characters":
+				apiRespond(rw, http.StatusOK, append([]types.Character{}, job.Characters...))
+			case "messages":
+				apiListMessages(job, rw, req)
+			default:
+				apiRespond(rw, http.StatusNotFound, apiError{Error: "no such endpoint"})
+			}
+		default:
+			apiRespond(rw, http.StatusNotFound, apiError{Error: "no such endpoint"})
+		}
+	}
+}
+
+// apiRespond writes v as the JSON response body, with the given status code.
+func apiRespond(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("content-type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		log.Errorf("encoding API response: %v", err)
+	}
+}
+
+// apiMethod returns true if the request uses one of the given methods, or else responds with an error.
+func apiMethod(rw http.ResponseWriter, req *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	rw.Header().Set("Allow", strings.Join(methods, ", "))
+	apiRespond(rw, http.StatusMethodNotAllowed, apiError{
+		Error: "method not allowed; use " + strings.Join(methods, " or "),
+	})
+	return false
+}
+
+func apiOpenAPI(rw http.ResponseWriter, req *http.Request) {
+	f, err := assets.Open("/api/openapi.json")
+	if err != nil {
+		log.Errorf("opening OpenAPI document: %v", err)
+		apiRespond(rw, http.StatusInternalServerError, apiError{Error: "internal server error"})
+		return
+	}
+	defer f.Close()
+	http.ServeContent(rw, req, "openapi.json", time.Time{}, f)
+}
+
+// apiCreateJob starts a job for the email and password given as JSON or form values.
+func apiCreateJob(queue *Queue, rw http.ResponseWriter, req *http.Request) {
+	var creds struct {
+		Email    string
+		Password string
+	}
+	if strings.HasPrefix(req.Header.Get("content-type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, 1<<16)).Decode(&creds); err != nil {
+			apiRespond(rw, http.StatusBadRequest, apiError{Error: "could not parse request body: " + err.Error()})
+			return
+		}
+	} else if err := req.ParseForm(); err != nil {
+		apiRespond(rw, http.StatusBadRequest, apiError{Error: "could not parse request: " + err.Error()})
+		return
+	} else {
+		creds.Email, creds.Password = req.FormValue("email"), req.FormValue("password")
+	}
+
+	if creds.Email == "" || creds.Password == "" {
+		apiRespond(rw, http.StatusBadRequest, apiError{Error: "email and password are required"})
+		return
+	}
+
+	job, err := newJob(creds.Email, creds.Password)
+	if err != nil {
+		log.Error(err)
+		apiRespond(rw, http.StatusInternalServerError, apiError{Error: "internal server error"})
+		return
+	}
+
+	// The existing job's ID is not returned, even to the same account.
+	existingId, err := queue.Add(job, &Checkpoint{})
+	if err == ErrQueueFull {
+		rw.Header().Set("Retry-After", "60")
+		apiRespond(rw, http.StatusServiceUnavailable, apiError{Error: err.Error()})
+		return
+	}
+	if existingId != "" || err == ErrAlreadyQueued {
+		apiRespond(rw, http.StatusConflict, apiError{Error: ErrAlreadyQueued.Error()})
+		return
+	}
+
+	rw.Header().Set("Location", apiPrefix+"jobs/"+job.JobId)
+	apiRespond(rw, http.StatusAccepted, newApiJob(job))
+}
+
+// apiDeleteJob deletes the job, if it is finished.
+func apiDeleteJob(store Store, job *Job, rw http.ResponseWriter) {
+	deleted, err := DeleteJob(store, job.JobId)
+	if err != nil {
+		log.Error(err)
+		apiRespond(rw, http.StatusInternalServerError, apiError{Error: "internal server error"})
+		return
+	}
+	if !deleted {
+		apiRespond(rw, http.StatusConflict, apiError{Error: "the job is still waiting or running"})
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// apiListSessions lists a page of the job's sessions, as selected by `mode` and parseSessionQuery.
+func apiListSessions(job *Job, rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	filter, order, err := parseSessionQuery(query)
+	if err != nil {
+		apiRespond(rw, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	sessions, err := job.Select(query.Get("mode"), filter, order)
+	if err != nil {
+		apiRespond(rw, http.StatusBadRequest, apiError{Error: err.Error()})
+		return
+	}
+
+	page := apiSessions{Limit: apiDefaultLimit}
+	if page.Offset, err = apiInt(query.Get("offset"), 0); err != nil || page.Offset < 0 {
+		apiRespond(rw, http.StatusBadRequest, apiError{Error: "offset must be a number, at least 0"})
+		return
+	}
+	if page.Limit, err = apiInt(query.Get("limit"), apiDefaultLimit); err != nil || page.Limit < 1 ||
+		page.Limit > apiMaxLimit {
+		apiRespond(rw, http.StatusBadRequest, apiError{
+			Error: "limit must be a number from 1 to " + strconv.Itoa(apiMaxLimit),
+		})
+		return
+	}
+
+	page.Total = len(sessions)
+	if page.Offset > len(sessions) {
+		page.Offset = len(sessions)
+	}
+	sessions = sessions[page.Offset:]
+	if len(sessions) > page.Limit {
+		sessions = sessions[:page.Limit]
+	}
+	page.Sessions = sessions
+	apiRespond(rw, http.StatusOK, page)
+}
+
+// apiListMessages lists the job's messages, or those at or after the RFC3339 time `since`.
+func apiListMessages(job *Job, rw http.ResponseWriter, req *http.Request) {
+	var since time.Time
+	if s := req.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			apiRespond(rw, http.StatusBadRequest, apiError{Error: "since must be an RFC3339 time"})
+			return
+		}
+	}
+
+	messages := []*types.JobMessage{}
+	for _, message := range job.Messages {
+		if !message.Time.Before(since) {
+			messages = append(messages, message)
+		}
+	}
+	apiRespond(rw, http.StatusOK, messages)
+}
+
+// apiInt parses s as an integer, or returns def if s is empty.
+func apiInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
@@ -3,13 +3,41 @@ package main
 import (
 	"crypto/rand"
 	"fmt"
-	"github.com/coreos/bbolt"
 	"github.com/pdbogen/autopfs/types"
 	"net/http"
 	"sync"
+	"time"
 )
 
-func Begin(db *bbolt.DB, jobsWg *sync.WaitGroup) func(rw http.ResponseWriter, req *http.Request) {
+// newJobId returns a new, random job ID.
+func newJobId() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if n, err := rand.Read(tokenBytes); n != 32 {
+		return "", fmt.Errorf("could not generate token bytes: %s", err)
+	}
+	return fmt.Sprintf("%x", tokenBytes), nil
+}
+
+// newJob returns a new job, with a new ID, to retrieve the sessions of the given Paizo account.
+func newJob(email, pass string) (*Job, error) {
+	token, err := newJobId()
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		Job: types.Job{
+			JobId:   token,
+			State:   "init",
+			Email:   email,
+			Pass:    pass,
+			JobDate: time.Now(),
+			Owner:   ownerOf(email),
+		},
+		SubscriptionsMu: &sync.Mutex{},
+	}, nil
+}
+
+func Begin(store Store, queue *Queue) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
 
 		if err := req.ParseForm(); err != nil {
@@ -27,46 +55,32 @@ func Begin(db *bbolt.DB, jobsWg *sync.WaitGroup) func(rw http.ResponseWriter, re
 
 		if pass == "" {
 			http.Error(rw, "Sorry, password is required. Go back and try again?", http.StatusBadRequest)
+			return
 		}
 
-		tokenBytes := make([]byte, 32)
-		if n, err := rand.Read(tokenBytes); n != 32 {
-			log.Errorf("could not generate token bytes: %s", err)
+		job, err := newJob(email, pass)
+		if err != nil {
+			log.Error(err)
 			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
 			return
 		}
-		token := fmt.Sprintf("%x", tokenBytes)
+		token := job.JobId
 
-		job := &Job{
-			Job: types.Job{
-				JobId:    token,
-				State:    "init",
-				Sessions: nil,
-				Email:    email,
-				Pass:     pass,
-			},
-			SubscriptionsMu: &sync.Mutex{},
+		existingId, err := queue.Add(job, &Checkpoint{})
+		if err == ErrQueueFull {
+			http.Error(rw, msgQueueFull, http.StatusServiceUnavailable)
+			return
 		}
-
-		if err := job.Save(db); err != nil {
-			log.Errorf("saving job %q to DB: %v", token, err)
-			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+		if err == ErrAlreadyQueued {
+			http.Error(rw, msgAlreadyQueued, http.StatusConflict)
 			return
 		}
-
-		jobsWg.Add(1)
-		go job.Run(db, jobsWg)
-
-		histories := ""
-		history, _ := req.Cookie("history")
-		if history != nil {
-			histories = history.Value + ","
+		if existingId != "" {
+			http.Redirect(rw, req, "/status?id="+existingId, http.StatusFound)
+			return
 		}
 
-		http.SetCookie(rw, &http.Cookie{
-			Value: histories,
-			Name:  "history",
-		})
+		rememberJob(store, rw, req, token)
 		http.Redirect(rw, req, "/status?id="+token, http.StatusFound)
 	}
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Cancel cancels a waiting or running job, and returns to its status page.
+func Cancel(queue *Queue) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		if req.Method != http.MethodPost {
+			http.Error(rw, "Sorry, jobs can only be cancelled with the button on their status page.",
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := req.FormValue("id")
+		if id == "" {
+			http.Error(rw, "Sorry; I can't cancel a request without a request id.", http.StatusBadRequest)
+			return
+		}
+
+		if !queue.Cancel(id) {
+			log.Debugf("cancel requested for job %q, which is not waiting or running", id)
+		}
+		http.Redirect(rw, req, "/status?id="+id+"&view=true", http.StatusFound)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Delete deletes a finished job and its checkpoint, and returns to the index page.
+func Delete(store Store) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		if req.Method != http.MethodPost {
+			http.Error(rw, "Sorry, jobs can only be deleted with the button on their results or status page.",
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := req.FormValue("id")
+		if id == "" {
+			http.Error(rw, "Sorry; I can't delete a request without a request id.", http.StatusBadRequest)
+			return
+		}
+
+		job, err := Load(store, id)
+		if err != nil {
+			log.Errorf("retrieving job %q from DB: %v", id, err)
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.Error(rw, "Sorry, I could not find that job; perhaps it was already deleted?", http.StatusNotFound)
+			return
+		}
+
+		deleted, err := DeleteJob(store, id)
+		if err != nil {
+			log.Error(err)
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(rw, "Sorry, that job is still running. Cancel it first, and then delete it.", http.StatusConflict)
+			return
+		}
+		if user, err := currentUser(store, req); err != nil {
+			log.Errorf("finding signed-in user: %v", err)
+		} else if user != nil {
+			if err := user.RemoveJobs(store, []string{id}); err != nil {
+				log.Error(err)
+			}
+		}
+		http.Redirect(rw, req, "/", http.StatusFound)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/pdbogen/autopfs/report"
+	"net/http"
+)
+
+// Diff shows what changed between two jobs: the older one named by `a`, and the newer one named by `b`.
+func Diff(store Store, JsHash, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		aId, bId := req.FormValue("a"), req.FormValue("b")
+		if aId == "" || bId == "" {
+			http.Error(rw, "Sorry; I need two request ids, a and b, to compare.", http.StatusBadRequest)
+			return
+		}
+
+		jobs := map[string]*Job{}
+		for _, id := range []string{aId, bId} {
+			job, err := Load(store, id)
+			if err != nil {
+				http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+				return
+			}
+			if job == nil {
+				http.NotFound(rw, req)
+				return
+			}
+			if !job.Done() {
+				http.Redirect(rw, req, "/status?id="+id, http.StatusFound)
+				return
+			}
+			jobs[id] = job
+		}
+
+		rw.Header().Set("Content-Type", "text/html")
+		rw.WriteHeader(http.StatusOK)
+		if err := TemplateRoot.ExecuteTemplate(rw, "diff", map[string]interface{}{
+			"Title":   "What's Changed?",
+			"A":       jobs[aId],
+			"B":       jobs[bId],
+			"Diff":    report.Diff(jobs[aId].Job, jobs[bId].Job),
+			"JsHash":  JsHash,
+			"CssHash": CssHash,
+		}); err != nil {
+			log.Errorf("Executing diff template: %v", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/pdbogen/autopfs/eligibility"
+	"net/http"
+	"strconv"
+)
+
+// Eligibility reports, as JSON, whether the job's characters can play or GM the scenario named by the `scenario`
+// parameter for credit. If `character` is given, only that character is checked.
+func Eligibility(store Store) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		id := req.FormValue("id")
+		if id == "" {
+			http.Error(rw, "Sorry; I can't check eligibility without a request id.", http.StatusBadRequest)
+			return
+		}
+
+		scenario := req.FormValue("scenario")
+		if scenario == "" {
+			http.Error(rw, "Sorry; I can't check eligibility without a scenario.", http.StatusBadRequest)
+			return
+		}
+
+		job, err := Load(store, id)
+		if err != nil {
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.NotFound(rw, req)
+			return
+		}
+
+		if !job.Done() {
+			http.Redirect(rw, req, "/status?id="+id, http.StatusFound)
+			return
+		}
+
+		checker := eligibility.New(job.Job)
+		var results []*eligibility.Result
+		if charStr := req.FormValue("character"); charStr != "" {
+			character, err := strconv.Atoi(charStr)
+			if err != nil {
+				http.Error(rw, "Sorry; the character should be a number, like 701.", http.StatusBadRequest)
+				return
+			}
+			result, err := checker.Check(scenario, character)
+			if err != nil {
+				http.Error(rw, "Sorry; "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			results = append(results, result)
+		} else {
+			if results, err = checker.CheckAll(scenario); err != nil {
+				http.Error(rw, "Sorry; "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		rw.Header().Set("content-type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(rw).Encode(results); err != nil {
+			log.Errorf("encoding eligibility JSON for job %q: %s", job.JobId, err)
+		}
+	}
+}
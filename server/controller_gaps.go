@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/csv"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/report"
+	"net/http"
+	"strconv"
+)
+
+var gapsCsvHeader = []string{"Game", "Type", "Season", "Number", "Scenario Name", "Status"}
+
+// Gaps shows, for each season in the scenario catalog, which scenarios the job has not played or GMed. If csvOut is
+// true, the same report is downloaded as CSV instead.
+func Gaps(store Store, JsHash, CssHash string, csvOut bool) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		id := req.FormValue("id")
+		if id == "" {
+			http.Error(rw, "Sorry; I can't build a report without a request id.", http.StatusBadRequest)
+			return
+		}
+
+		job, err := Load(store, id)
+		if err != nil {
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.NotFound(rw, req)
+			return
+		}
+
+		if !job.Done() {
+			http.Redirect(rw, req, "/status?id="+id, http.StatusFound)
+			return
+		}
+
+		gaps := report.Gaps(job.AllPlays(), paizo.CurrentCatalog())
+
+		if csvOut {
+			rw.Header().Set("Content-Type", "text/csv")
+			rw.Header().Set("Content-Disposition", "attachment;filename=gaps.csv")
+			rw.WriteHeader(http.StatusOK)
+
+			csvW := csv.NewWriter(rw)
+			csvW.Write(gapsCsvHeader)
+			for _, season := range gaps {
+				for _, list := range [][]*report.GapScenario{season.Unplayed, season.NotGMed} {
+					for _, scen := range list {
+						csvW.Write([]string{season.Game, season.Type, strconv.Itoa(season.Season), scen.Code,
+							scen.Name, scen.Status})
+					}
+				}
+			}
+			csvW.Flush()
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/html")
+		rw.WriteHeader(http.StatusOK)
+		if err := TemplateRoot.ExecuteTemplate(rw, "gaps", map[string]interface{}{
+			"Title":   "What Haven't I Played?",
+			"id":      job.JobId,
+			"Gaps":    gaps,
+			"JsHash":  JsHash,
+			"CssHash": CssHash,
+		}); err != nil {
+			log.Errorf("Executing gaps template: %v", err)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
-	bolt "github.com/coreos/bbolt"
 	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+	"html/template"
 	"net/http"
 )
 
-func Html(db *bolt.DB, JsHash string, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
+func Html(store Store, JsHash string, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		if err := req.ParseForm(); err != nil {
 			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
@@ -19,7 +20,7 @@ func Html(db *bolt.DB, JsHash string, CssHash string) func(rw http.ResponseWrite
 			return
 		}
 
-		job, err := Load(db, id)
+		job, err := Load(store, id)
 		if err != nil {
 			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
 			return
@@ -29,11 +30,18 @@ func Html(db *bolt.DB, JsHash string, CssHash string) func(rw http.ResponseWrite
 			return
 		}
 
-		if !job.Done() {
+		// Running jobs show their results as they are read; see statusWebsocket.
+		if job.Finished() && !job.Done() {
 			http.Redirect(rw, req, "/status?id="+id, http.StatusFound)
 			return
 		}
 
+		if _, _, err := parseSessionQuery(req.Form); err != nil {
+			http.Error(rw, "Sorry, "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		mode := req.FormValue("mode")
+
 		rw.Header().Set("Content-Type", "text/html")
 		rw.WriteHeader(http.StatusOK)
 
@@ -41,9 +49,17 @@ func Html(db *bolt.DB, JsHash string, CssHash string) func(rw http.ResponseWrite
 			"Title":   "HTML View",
 			"Desc":    req.FormValue("desc"),
 			"id":      job.JobId,
-			"Headers": paizo.CsvHeader,
-			"JsHash":  JsHash,
-			"CssHash": CssHash,
+			"Mode":    mode,
+			"Running": !job.Finished(),
+			"Form":    req.Form,
+			"Filters": activeFilters(job.JobId, mode, req.Form),
+			// Query, MergedQuery, and PlaysQuery keep the page's filter and order; see parseSessionQuery.
+			"Query":       template.URL(sessionQuery(job.JobId, mode, req.Form)),
+			"MergedQuery": template.URL(sessionQuery(job.JobId, "", req.Form)),
+			"PlaysQuery":  template.URL(sessionQuery(job.JobId, types.ModePlays, req.Form)),
+			"Headers":     paizo.CsvHeader,
+			"JsHash":      JsHash,
+			"CssHash":     CssHash,
 		})
 
 		if err != nil {
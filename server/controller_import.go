@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxImportBytes limits the size of uploaded files.
+const maxImportBytes = 10 << 20
+
+// readImport reads a job saved from a /json page, or the sessions of a CSV export from a /csv page or the CLI.
+func readImport(r io.Reader) (*types.Job, error) {
+	buf := bufio.NewReader(r)
+	first, err := buf.Peek(1)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %v", err)
+	}
+
+	if first[0] == '{' {
+		job := &types.Job{}
+		if err := json.NewDecoder(buf).Decode(job); err != nil {
+			return nil, err
+		}
+		if job.Schema > jobSchema {
+			return nil, fmt.Errorf("it was saved by a newer version of AutoPFS")
+		}
+		upgradeJob(job)
+		return job, nil
+	}
+
+	sessions, err := paizo.ReadCsv(buf)
+	if err != nil {
+		return nil, err
+	}
+	return types.JobFromSessions(sessions), nil
+}
+
+// importFile creates a completed job from the JSON or CSV file at path; see readImport.
+func importFile(store Store, path string) (*Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	imported, err := readImport(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %v", path, err)
+	}
+
+	token, err := newJobId()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{Job: *imported, SubscriptionsMu: &sync.Mutex{}}
+	job.JobId = token
+	job.Messages = nil
+	if err := job.UpdateStatus(store, types.JobStateDone, fmt.Sprintf("Imported %d sessions from %s.",
+		len(job.AllPlays()), filepath.Base(path))); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Import shows a form for uploading a /json or CSV export, and starts a job that reads it instead of Paizo.
+func Import(store Store, queue *Queue, JsHash, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			rw.Header().Set("Content-Type", "text/html")
+			rw.WriteHeader(http.StatusOK)
+			if err := TemplateRoot.ExecuteTemplate(rw, "import", map[string]interface{}{
+				"Title":   "Import",
+				"JsHash":  JsHash,
+				"CssHash": CssHash,
+			}); err != nil {
+				log.Errorf("Executing import template: %v", err)
+			}
+			return
+		}
+
+		req.Body = http.MaxBytesReader(rw, req.Body, maxImportBytes)
+		file, _, err := req.FormFile("file")
+		if err != nil {
+			http.Error(rw, "Sorry, I didn't get a file. Go back and try again?", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		imported, err := readImport(file)
+		if err != nil {
+			http.Error(rw, "Sorry, I couldn't read that file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(imported.AllPlays()) == 0 && len(imported.Characters) == 0 {
+			http.Error(rw, "Sorry, that file has no characters or sessions in it.", http.StatusBadRequest)
+			return
+		}
+
+		token, err := newJobId()
+		if err != nil {
+			log.Error(err)
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		job := &Job{
+			Job: types.Job{
+				JobId:   token,
+				State:   "init",
+				JobDate: time.Now(),
+			},
+			SubscriptionsMu: &sync.Mutex{},
+		}
+
+		if _, err := queue.Add(job, &Checkpoint{Import: imported}); err == ErrQueueFull {
+			http.Error(rw, msgQueueFull, http.StatusServiceUnavailable)
+			return
+		}
+
+		rememberJob(store, rw, req, token)
+		http.Redirect(rw, req, "/status?id="+token, http.StatusFound)
+	}
+}
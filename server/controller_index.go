@@ -1,38 +1,40 @@
 package main
 
 import (
-	"github.com/coreos/bbolt"
 	"net/http"
-	"strings"
 )
 
-func IndexController(db *bbolt.DB, JsHash, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
+// IndexController shows the form for starting a job, and the jobs of the signed-in user; or, if the browser is not
+// signed in, the jobs remembered by its history cookie.
+func IndexController(store Store, JsHash, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		context := map[string]interface{}{
 			"JsHash":  JsHash,
 			"CssHash": CssHash,
 		}
-		histories, _ := req.Cookie("history")
-		var jobs []*Job
-		if histories != nil {
-			var err error
-			historyIdList := strings.Split(histories.Value, ",")
-			jobs, err = LoadMany(db, historyIdList)
+
+		user, err := currentUser(store, req)
+		if err != nil {
+			log.Errorf("finding signed-in user: %v", err)
+		}
+		if user != nil {
+			context["User"] = user
+			context["Jobs"] = userJobs(store, user)
+		} else if history := historyCookie(req); len(history) > 0 {
+			jobs, err := LoadMany(store, history)
 			if err != nil {
 				log.Errorf("loading jobs: %s", err)
 			}
-			context["jobs"] = jobs
-		}
-
-		var historyIdList []string
-		for _, job := range jobs {
-			historyIdList = append(historyIdList, job.JobId)
+			if missing := missingJobs(history, jobs); len(missing) > 0 && err == nil {
+				var historyIdList []string
+				for _, job := range jobs {
+					historyIdList = append(historyIdList, job.JobId)
+				}
+				setHistoryCookie(rw, historyIdList)
+			}
+			context["Jobs"] = newestFirst(jobs)
 		}
 
-		http.SetCookie(rw, &http.Cookie{
-			Value: strings.Join(historyIdList, ","),
-			Name:  "history",
-		})
 		rw.Header().Add("content-type", "text/html")
 		rw.WriteHeader(http.StatusOK)
 		if err := TemplateRoot.ExecuteTemplate(rw, "index", context); err != nil {
@@ -40,3 +42,26 @@ func IndexController(db *bbolt.DB, JsHash, CssHash string) func(rw http.Response
 		}
 	}
 }
+
+// missingJobs returns the IDs that are not among the loaded jobs; e.g., because the jobs were deleted.
+func missingJobs(jobIds []string, jobs []*Job) []string {
+	found := map[string]bool{}
+	for _, job := range jobs {
+		found[job.JobId] = true
+	}
+	ret := []string{}
+	for _, id := range jobIds {
+		if !found[id] {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
+// newestFirst reverses the jobs, which are remembered oldest first.
+func newestFirst(jobs []*Job) []*Job {
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+	return jobs
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"encoding/json"
-	"github.com/coreos/bbolt"
+	"github.com/pdbogen/autopfs/types"
 	"net/http"
 )
 
-func GetJob(db *bbolt.DB) func(rw http.ResponseWriter, req *http.Request) {
+// jobView is a Job as sent by GetJob, with Sessions listed in the requested mode, filter, and order; see
+// parseSessionQuery.
+type jobView struct {
+	Job
+	Groups []*types.SessionGroup `json:",omitempty"`
+}
+
+func GetJob(store Store) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		if err := req.ParseForm(); err != nil {
 			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
@@ -19,24 +26,43 @@ func GetJob(db *bbolt.DB) func(rw http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		job, err := Load(db, id)
+		job, err := Load(store, id)
 		if err != nil {
 			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
 			return
 		}
 		if job == nil {
 			http.NotFound(rw, req)
+			return
 		}
 
-		if !job.Done() {
+		// A running job is sent with whatever results it has so far; e.g. its previous sessions, if it is being
+		// refreshed.
+		if job.Finished() && !job.Done() {
 			http.Redirect(rw, req, "/status?id="+id, http.StatusFound)
 			return
 		}
 
+		filter, order, err := parseSessionQuery(req.Form)
+		if err != nil {
+			http.Error(rw, "Sorry, "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mode := req.FormValue("mode")
+		view := jobView{Job: *job}
+		if view.Sessions, err = job.Select(mode, filter, order); err != nil {
+			http.Error(rw, "Sorry, "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if mode == types.ModeGrouped {
+			view.Groups = job.SelectGroups(filter, order)
+		}
+
 		rw.Header().Set("content-type", "application/json")
 		rw.WriteHeader(http.StatusOK)
 		enc := json.NewEncoder(rw)
-		if err := enc.Encode(job); err != nil {
+		if err := enc.Encode(view); err != nil {
 			log.Errorf("encoding JSON for job %q: %s", job.JobId, err)
 		}
 	}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics reports the DB's size and the number of jobs pruned, in the Prometheus text format.
+func Metrics(store Store) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		stats, err := store.Stats()
+		if err != nil {
+			log.Errorf("reading DB stats: %v", err)
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(rw, "# HELP autopfs_db_size_bytes Size of the DB file.")
+		fmt.Fprintln(rw, "# TYPE autopfs_db_size_bytes gauge")
+		fmt.Fprintf(rw, "autopfs_db_size_bytes %d\n", stats.Size)
+		fmt.Fprintln(rw, "# HELP autopfs_db_free_bytes Bytes of free pages in the DB file, which new data reuses.")
+		fmt.Fprintln(rw, "# TYPE autopfs_db_free_bytes gauge")
+		fmt.Fprintf(rw, "autopfs_db_free_bytes %d\n", stats.Free)
+		fmt.Fprintln(rw, "# HELP autopfs_bucket_keys Number of records in each bucket or table, e.g. jobs.")
+		fmt.Fprintln(rw, "# TYPE autopfs_bucket_keys gauge")
+		for _, name := range storeTables {
+			fmt.Fprintf(rw, "autopfs_bucket_keys{bucket=%q} %d\n", name, stats.Records[name])
+		}
+		if stats.Inuse != nil {
+			fmt.Fprintln(rw, "# HELP autopfs_bucket_inuse_bytes Bytes of pages used by each bucket.")
+			fmt.Fprintln(rw, "# TYPE autopfs_bucket_inuse_bytes gauge")
+			for _, name := range storeTables {
+				fmt.Fprintf(rw, "autopfs_bucket_inuse_bytes{bucket=%q} %d\n", name, stats.Inuse[name])
+			}
+		}
+		fmt.Fprintln(rw, "# HELP autopfs_jobs_pruned_total Jobs deleted by the retention policy.")
+		fmt.Fprintln(rw, "# TYPE autopfs_jobs_pruned_total counter")
+		fmt.Fprintf(rw, "autopfs_jobs_pruned_total %d\n", atomic.LoadInt64(&jobsPruned))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Refresh shows a form asking for the Paizo email and password of a completed job, which are not stored; and, when it
+// is submitted, starts refreshing that job with any newly-reported sessions.
+func Refresh(store Store, queue *Queue, JsHash, CssHash string) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
+			return
+		}
+
+		id := req.FormValue("id")
+		if id == "" {
+			http.Error(rw, "Sorry; I can't refresh a request without a request id.", http.StatusBadRequest)
+			return
+		}
+
+		job, err := Load(store, id)
+		if err != nil {
+			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			http.NotFound(rw, req)
+			return
+		}
+
+		if !job.Done() {
+			http.Redirect(rw, req, "/status?id="+id, http.StatusFound)
+			return
+		}
+
+		if req.Method != http.MethodPost {
+			rw.Header().Set("Content-Type", "text/html")
+			rw.WriteHeader(http.StatusOK)
+			if err := TemplateRoot.ExecuteTemplate(rw, "refresh", map[string]interface{}{
+				"Title":   "Refresh",
+				"id":      job.JobId,
+				"JsHash":  JsHash,
+				"CssHash": CssHash,
+			}); err != nil {
+				log.Errorf("Executing refresh template: %v", err)
+			}
+			return
+		}
+
+		job.Email = req.PostFormValue("email")
+		job.Pass = req.PostFormValue("password")
+		if job.Email == "" || job.Pass == "" {
+			http.Error(rw, "Sorry, email address and password are required. Go back and try again?", http.StatusBadRequest)
+			return
+		}
+		// Jobs saved before owners were recorded get one now.
+		if job.Owner == "" {
+			job.Owner = ownerOf(job.Email)
+		}
+
+		// The status page replays a job's whole log, and would otherwise see the previous run's "done" and move on.
+		since := time.Now()
+		existingId, err := queue.Add(job, &Checkpoint{Refresh: true})
+		if err == ErrQueueFull {
+			http.Error(rw, msgQueueFull, http.StatusServiceUnavailable)
+			return
+		}
+		if err == ErrAlreadyQueued {
+			http.Error(rw, msgAlreadyQueued, http.StatusConflict)
+			return
+		}
+		if existingId != "" {
+			http.Redirect(rw, req, "/status?id="+existingId, http.StatusFound)
+			return
+		}
+
+		http.Redirect(rw, req, "/status?id="+id+"&since="+since.Format(time.RFC3339Nano), http.StatusFound)
+	}
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
-	"github.com/coreos/bbolt"
 	"github.com/gorilla/websocket"
+	"github.com/pdbogen/autopfs/types"
 	"net/http"
 	"time"
 )
 
-func Status(db *bbolt.DB, JsHash, CssHash string, websocket bool) func(rw http.ResponseWriter, req *http.Request) {
+func Status(store Store, JsHash, CssHash string, websocket bool) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		if err := req.ParseForm(); err != nil {
 			http.Error(rw, "hmm, that request didn't look right. Go back and try again, perhaps?", http.StatusBadRequest)
@@ -20,7 +20,7 @@ func Status(db *bbolt.DB, JsHash, CssHash string, websocket bool) func(rw http.R
 			return
 		}
 
-		job, err := Load(db, id)
+		job, err := Load(store, id)
 		if err != nil {
 			log.Errorf("retrieving job %q from DB: %v", id, err)
 			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
@@ -37,7 +37,7 @@ func Status(db *bbolt.DB, JsHash, CssHash string, websocket bool) func(rw http.R
 			return
 		}
 
-		statusWebsocket(job, rw, req)
+		statusWebsocket(store, job, rw, req)
 	}
 }
 
@@ -53,9 +53,11 @@ func statusPage(job *Job, JsHash, CssHash string, rw http.ResponseWriter, req *h
 	}
 }
 
-// statusWebsocket upgrades the request to a websocket, over which it sends any new messages after `since`
-func statusWebsocket(job *Job, rw http.ResponseWriter, req *http.Request) {
+// statusWebsocket sends a types.JobFrame over a websocket for each message after `since`, and with `results`, for
+// each character and session.
+func statusWebsocket(store Store, job *Job, rw http.ResponseWriter, req *http.Request) {
 	sinceStr := req.FormValue("since")
+	results := req.FormValue("results") != ""
 
 	// discard the error, we'll just get zero time instead.
 	since, _ := time.Parse(time.RFC3339Nano, sinceStr)
@@ -69,27 +71,73 @@ func statusWebsocket(job *Job, rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	defer conn.Close()
+
 	stream := Subscribe(job.JobId)
 	defer stream.Unsubscribe()
 
+	backfill := []*types.JobFrame{}
 	last := job.Messages[len(job.Messages)-1].Time
 	for _, message := range job.Messages {
 		if message.Time.Before(since) {
 			continue
 		}
-		log.Debugf("sending backfill message %+v", message)
-		if err := conn.WriteJSON(message); err != nil {
+		backfill = append(backfill, &types.JobFrame{Type: types.FrameMessage, Message: message})
+	}
+
+	if results {
+		for i := range job.Characters {
+			backfill = append(backfill, &types.JobFrame{Type: types.FrameCharacter, Character: &job.Characters[i]})
+		}
+		cp, err := store.LoadCheckpoint(job.JobId)
+		if err != nil {
+			log.Errorf("loading checkpoint for job %q: %v", job.JobId, err)
+		}
+		if cp != nil && !job.Finished() {
+			for _, sess := range append(append([]*types.Session(nil), cp.Player...), cp.GM...) {
+				backfill = append(backfill, &types.JobFrame{Type: types.FrameSession, Session: sess})
+			}
+		}
+	}
+
+	for _, frame := range backfill {
+		log.Debugf("sending backfill frame %+v", frame)
+		if err := conn.WriteJSON(frame); err != nil {
 			log.Error("writing to websocket: %s", err)
 			return
 		}
 	}
 
-	for message := range stream.Chan {
-		if message.Time.Before(last) {
+	// The client sends nothing, but reading notices when it goes away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var frame *types.JobFrame
+		select {
+		case frame = <-stream.Chan:
+		case <-stream.Dropped:
+			// The client reconnects, and is sent what it missed.
+			log.Warningf("websocket for job %q fell behind; closing it", job.JobId)
+			return
+		case <-gone:
+			return
+		}
+		if frame.Type == types.FrameMessage && frame.Message.Time.Before(last) {
+			continue
+		}
+		if frame.Type != types.FrameMessage && !results {
 			continue
 		}
-		log.Debugf("sending message %+v", message)
-		if err := conn.WriteJSON(message); err != nil {
+		log.Debugf("sending frame %+v", frame)
+		if err := conn.WriteJSON(frame); err != nil {
 			log.Error("writing to websocket: %s", err)
 			return
 		}
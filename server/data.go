@@ -2,3 +2,9 @@ package main
 
 const msgInternalServerError = "so sorry! something went wrong; please contact pdbogen at cernu dot us via email and " +
 	"let him know"
+
+const msgQueueFull = "Sorry, too many people are retrieving their sessions right now. Please try again in a few " +
+	"minutes."
+
+const msgAlreadyQueued = "Sorry, sessions are already being retrieved for that account. Please wait for that to " +
+	"finish, then try again."
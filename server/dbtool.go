@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pdbogen/autopfs/types"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dbCommand inspects or repairs the bolt DB, instead of running the server:
+//
+//	db inspect [flags] [ID...]   report on the DB, and on the jobs with the given IDs
+//	db repair [flags] [ID...]    fix what inspect reports, and upgrade the jobs with the given IDs
+//
+// The server must not be running.
+func dbCommand(args []string) {
+	if len(args) < 1 || (args[0] != "inspect" && args[0] != "repair") {
+		fmt.Fprintf(os.Stderr, "Usage: %s db inspect [flags] [ID...]\n       %s db repair [flags] [ID...]\n\n"+
+			"inspect reports on the DB, and on the jobs with the given IDs, if any.\n"+
+			"repair applies any pending migrations, moves unreadable records to the quarantine bucket, removes "+
+			"checkpoints without jobs, expired logins, and users' references to deleted jobs, and upgrades the jobs "+
+			"with the given IDs and those of users.\n\nThe server must not be running.\n", os.Args[0], os.Args[0])
+		os.Exit(2)
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("db "+command, flag.ExitOnError)
+	dbPath := fs.String("db-path", "sessions.db", "path to the bolt DB")
+	keyPath := fs.String("key-path", "autopfs.key", "path to the server's credentials key, which is needed to "+
+		"find the IDs of unfinished jobs and users' jobs; it is not created if it does not exist")
+	fs.Parse(args[1:])
+
+	if _, err := os.Stat(*keyPath); err == nil {
+		if credentialsKey, err = loadCredentialsKey(*keyPath); err != nil {
+			log.Fatalf("loading credentials key: %s", err)
+		}
+	} else {
+		fmt.Printf("No credentials key at %q; the IDs of unfinished jobs and users' jobs cannot be read.\n", *keyPath)
+	}
+
+	db, err := bolt.Open(*dbPath, os.FileMode(0640), &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("could not open bolt DB %q (is the server running?): %v", *dbPath, err)
+	}
+
+	if command == "repair" {
+		changed, err := repairDB(db, fs.Args())
+		if err != nil {
+			log.Fatalf("repairing bolt DB %q: %s", *dbPath, err)
+		}
+		if err := db.Close(); err != nil {
+			log.Fatalf("closing bolt DB %q: %s", *dbPath, err)
+		}
+		if changed > 0 {
+			if err := compactDB(*dbPath, os.FileMode(0640)); err != nil {
+				log.Fatalf("compacting bolt DB %q: %s", *dbPath, err)
+			}
+		}
+		fmt.Printf("Repaired %d records.\n\n", changed)
+		if db, err = bolt.Open(*dbPath, os.FileMode(0640), &bolt.Options{Timeout: time.Second}); err != nil {
+			log.Fatalf("could not open bolt DB %q: %v", *dbPath, err)
+		}
+	}
+	defer db.Close()
+
+	report, err := inspectDB(db)
+	if err != nil {
+		log.Fatalf("inspecting bolt DB %q: %s", *dbPath, err)
+	}
+	report.print(os.Stdout)
+	for _, id := range fs.Args() {
+		printJob(os.Stdout, db, id)
+	}
+}
+
+// dbReport is what `db inspect` finds in the DB, and `db repair` fixes.
+type dbReport struct {
+	Size        int64
+	Schema      int
+	Jobs        int
+	Unfinished  int
+	Checkpoints int
+	Users       int
+	Logins      int
+	Links       int
+	Quarantined int
+	// Unencrypted are the keys of jobs and checkpoints that are not yet encrypted; see encryptJobs.
+	Unencrypted map[string][]string
+	// Unreadable are the keys of jobs and checkpoints that can be neither opened nor encrypted, by bucket.
+	Unreadable map[string][]string
+	// Orphans are the keys of checkpoints without jobs.
+	Orphans []string
+	// Lost are the keys of unfinished jobs whose IDs cannot be read.
+	Lost []string
+	// Expired is the number of expired logins and links.
+	Expired int
+	// Dangling are the IDs of deleted jobs, by the email address of the user that still refers to them.
+	Dangling map[string][]string
+	// UserJobs are the IDs of users' jobs; only known if there is a credentials key.
+	UserJobs []string
+}
+
+func inspectDB(db *bolt.DB) (*dbReport, error) {
+	report := &dbReport{
+		Unencrypted: map[string][]string{},
+		Unreadable:  map[string][]string{},
+		Dangling:    map[string][]string{},
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		report.Size = tx.Size()
+		report.Schema = dbSchema(tx)
+
+		jobs := tx.Bucket([]byte("jobs"))
+		for _, name := range []string{"jobs", "checkpoints"} {
+			bucket := tx.Bucket([]byte(name))
+			if bucket == nil {
+				continue
+			}
+			err := bucket.ForEach(func(k, v []byte) error {
+				env, err := parseEnvelope(v)
+				if err == nil && env == nil {
+					if name == "jobs" && json.Unmarshal(v, &types.Job{}) != nil {
+						err = fmt.Errorf("not a job")
+					} else if name == "checkpoints" && json.Unmarshal(v, &Checkpoint{}) != nil {
+						err = fmt.Errorf("not a checkpoint")
+					} else {
+						report.Unencrypted[name] = append(report.Unencrypted[name], string(k))
+					}
+				}
+				if err != nil {
+					report.Unreadable[name] = append(report.Unreadable[name], string(k))
+					return nil
+				}
+
+				if name == "checkpoints" {
+					report.Checkpoints++
+					if jobs == nil || jobs.Get(k) == nil {
+						report.Orphans = append(report.Orphans, string(k))
+					}
+					return nil
+				}
+				report.Jobs++
+				if env != nil && !env.Finished {
+					report.Unfinished++
+					if id, err := env.jobId(); err != nil || id == "" {
+						report.Lost = append(report.Lost, string(k))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, name := range []string{"logins", "links"} {
+			bucket := tx.Bucket([]byte(name))
+			if bucket == nil {
+				continue
+			}
+			err := bucket.ForEach(func(k, v []byte) error {
+				if name == "logins" {
+					report.Logins++
+				} else {
+					report.Links++
+				}
+				l := login{}
+				if err := json.Unmarshal(v, &l); err != nil || time.Now().After(l.Expires) {
+					report.Expired++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if quarantine := tx.Bucket([]byte("quarantine")); quarantine != nil {
+			report.Quarantined = quarantine.Stats().KeyN
+		}
+
+		users := tx.Bucket([]byte("users"))
+		if users == nil {
+			return nil
+		}
+		return users.ForEach(func(k, v []byte) error {
+			report.Users++
+			user := &User{}
+			if err := unmarshalUser(v, user); err != nil {
+				return nil
+			}
+			for _, id := range user.Jobs {
+				// Jobs that are not yet encrypted are stored under their IDs.
+				if jobs != nil && (jobs.Get(jobStorageKey(id)) != nil || jobs.Get([]byte(id)) != nil) {
+					report.UserJobs = append(report.UserJobs, id)
+				} else {
+					report.Dangling[string(k)] = append(report.Dangling[string(k)], id)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *dbReport) print(w io.Writer) {
+	fmt.Fprintf(w, "Size: %d bytes\n", r.Size)
+	fmt.Fprintf(w, "Schema version: %d; this server knows up to %d", r.Schema, len(migrations))
+	for i := r.Schema; i < len(migrations); i++ {
+		fmt.Fprintf(w, "\n  pending migration: %s", migrations[i].Description)
+	}
+	fmt.Fprintf(w, "\nJobs: %d, of which %d are unfinished\n", r.Jobs, r.Unfinished)
+	fmt.Fprintf(w, "Checkpoints: %d\n", r.Checkpoints)
+	fmt.Fprintf(w, "Users: %d, with %d jobs\n", r.Users, len(r.UserJobs))
+	fmt.Fprintf(w, "Logins: %d; sign-in links: %d; of which %d have expired\n", r.Logins, r.Links, r.Expired)
+	fmt.Fprintf(w, "Quarantined records: %d\n", r.Quarantined)
+
+	printKeys(w, "Unencrypted jobs", r.Unencrypted["jobs"])
+	printKeys(w, "Unencrypted checkpoints", r.Unencrypted["checkpoints"])
+	printKeys(w, "Unreadable jobs", r.Unreadable["jobs"])
+	printKeys(w, "Unreadable checkpoints", r.Unreadable["checkpoints"])
+	printKeys(w, "Checkpoints without jobs", r.Orphans)
+	printKeys(w, "Unfinished jobs whose IDs cannot be read", r.Lost)
+	emails := []string{}
+	for email := range r.Dangling {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		printKeys(w, "Deleted jobs of user "+email, r.Dangling[email])
+	}
+}
+
+func printKeys(w io.Writer, title string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n  %s\n", title, strings.Join(keys, "\n  "))
+}
+
+// readJob returns the job as stored, without upgrading it, or nil; and whether it has a checkpoint.
+func readJob(db *bolt.DB, id string) (job *types.Job, hasCheckpoint bool, err error) {
+	var stored []byte
+	err = db.View(func(tx *bolt.Tx) error {
+		if jobs := tx.Bucket([]byte("jobs")); jobs != nil {
+			stored = append(stored, jobs.Get(jobStorageKey(id))...)
+		}
+		if checkpoints := tx.Bucket([]byte("checkpoints")); checkpoints != nil {
+			hasCheckpoint = checkpoints.Get(jobStorageKey(id)) != nil
+		}
+		return nil
+	})
+	if err != nil || len(stored) == 0 {
+		return nil, hasCheckpoint, err
+	}
+	jobJson, err := openRecord(id, stored)
+	if err != nil {
+		return nil, hasCheckpoint, err
+	}
+	job = &types.Job{}
+	if err := json.Unmarshal(jobJson, job); err != nil {
+		return nil, hasCheckpoint, err
+	}
+	return job, hasCheckpoint, nil
+}
+
+// printJob reports on the job with the given ID.
+func printJob(w io.Writer, db *bolt.DB, id string) {
+	fmt.Fprintf(w, "\nJob %s, stored as %s:\n", id, jobStorageKey(id))
+	job, hasCheckpoint, err := readJob(db, id)
+	if err != nil {
+		fmt.Fprintf(w, "  cannot read: %v\n", err)
+		return
+	}
+	if job == nil {
+		fmt.Fprintln(w, "  not found")
+		return
+	}
+	fmt.Fprintf(w, "  state: %s; started %s; last updated %s\n", job.State, job.JobDate.Format(time.RFC3339),
+		updated(job).Format(time.RFC3339))
+	fmt.Fprintf(w, "  schema version: %d; this server saves %d\n", job.Schema, jobSchema)
+	fmt.Fprintf(w, "  %d sessions, %d plays, %d characters, %d messages\n", len(job.Sessions), len(job.Plays),
+		len(job.Characters), len(job.Messages))
+	fmt.Fprintf(w, "  checkpoint: %v\n", hasCheckpoint)
+}
+
+// repairDB fixes what inspectDB reports, upgrades the given and users' jobs, and returns how many records changed.
+func repairDB(db *bolt.DB, jobIds []string) (int, error) {
+	changed, err := Migrate(db)
+	if err != nil {
+		return changed, err
+	}
+
+	report, err := inspectDB(db)
+	if err != nil {
+		return changed, err
+	}
+	if len(report.Unencrypted["jobs"])+len(report.Unencrypted["checkpoints"]) > 0 {
+		err := db.Update(func(tx *bolt.Tx) error {
+			n, err := encryptJobs(tx)
+			changed += n
+			return err
+		})
+		if err != nil {
+			return changed, err
+		}
+		if report, err = inspectDB(db); err != nil {
+			return changed, err
+		}
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for name, keys := range report.Unreadable {
+			quarantine, err := tx.CreateBucketIfNotExists([]byte("quarantine"))
+			if err != nil {
+				return fmt.Errorf("error opening quarantine bucket: %v", err)
+			}
+			bucket := tx.Bucket([]byte(name))
+			for _, k := range keys {
+				if err := quarantine.Put([]byte(name+"/"+k), bucket.Get([]byte(k))); err != nil {
+					return err
+				}
+				if err := bucket.Delete([]byte(k)); err != nil {
+					return err
+				}
+				fmt.Printf("Quarantined %s record %s\n", name, k)
+				changed++
+			}
+		}
+
+		for _, k := range report.Orphans {
+			if err := tx.Bucket([]byte("checkpoints")).Delete([]byte(k)); err != nil {
+				return err
+			}
+			fmt.Printf("Removed checkpoint without a job %s\n", k)
+			changed++
+		}
+		return nil
+	})
+	if err != nil {
+		return changed, err
+	}
+
+	if report.Expired > 0 {
+		if err := PruneLogins(&boltStore{db}); err != nil {
+			return changed, err
+		}
+		fmt.Printf("Removed %d expired logins and links\n", report.Expired)
+		changed += report.Expired
+	}
+
+	for email, ids := range report.Dangling {
+		user := &User{Email: email}
+		if err := user.RemoveJobs(&boltStore{db}, ids); err != nil {
+			return changed, err
+		}
+		fmt.Printf("Removed %d deleted jobs from user %s\n", len(ids), email)
+		changed++
+	}
+
+	outdated := []string{}
+	for _, id := range append(jobIds, report.UserJobs...) {
+		job, _, err := readJob(db, id)
+		if err != nil {
+			fmt.Printf("Cannot read job %s: %v\n", id, err)
+		} else if job != nil && job.Schema < jobSchema {
+			outdated = append(outdated, id)
+		}
+	}
+	// LoadMany upgrades and saves them.
+	if _, err := LoadMany(&boltStore{db}, outdated); err != nil {
+		return changed, err
+	}
+	if len(outdated) > 0 {
+		fmt.Printf("Upgraded %d jobs to schema version %d\n", len(outdated), jobSchema)
+	}
+	return changed + len(outdated), nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pdbogen/autopfs/types"
+	"time"
+)
+
+// Jobs and checkpoints are sealed with random data keys, which are sealed with keys derived from their job IDs.
+
+// envelope is a sealed job or checkpoint, as stored in the DB.
+type envelope struct {
+	// WrappedKey is the data key, sealed with the key derived from the job ID; see jobKey.
+	WrappedKey []byte
+	// Data is the JSON of the job or checkpoint, sealed with the data key.
+	Data []byte
+
+	// The rest is readable without the job's ID, for Retention and ResumeOrphans; it is not set for checkpoints.
+	Owner    string `json:",omitempty"`
+	Updated  time.Time
+	Finished bool `json:",omitempty"`
+	// SealedId is the ID of an unfinished job, sealed with credentialsKey; see unfinishedId.
+	SealedId []byte `json:",omitempty"`
+}
+
+var (
+	storageLabel = []byte("autopfs job storage key")
+	jobKeyLabel  = []byte("autopfs job data key")
+)
+
+// jobStorageKey returns the key under which the job with the given ID, and its checkpoint, are stored.
+func jobStorageKey(jobId string) []byte {
+	mac := hmac.New(sha256.New, storageLabel)
+	mac.Write([]byte(jobId))
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// jobKey returns the AES-256 key with which the data keys of the job with the given ID are sealed.
+func jobKey(jobId string) []byte {
+	mac := hmac.New(sha256.New, jobKeyLabel)
+	mac.Write([]byte(jobId))
+	return mac.Sum(nil)
+}
+
+// seal encrypts plain with the given AES-256 key, prefixing it with a random nonce.
+func seal(key, plain []byte) ([]byte, error) {
+	aead, err := newAead(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// unseal reverses seal.
+func unseal(key, sealed []byte) ([]byte, error) {
+	aead, err := newAead(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealRecord returns an envelope holding the given JSON of the job with the given ID, or of its checkpoint.
+func sealRecord(jobId string, recordJson []byte) (*envelope, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("generating data key: %v", err)
+	}
+	wrapped, err := seal(jobKey(jobId), dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("sealing data key: %v", err)
+	}
+	data, err := seal(dataKey, recordJson)
+	if err != nil {
+		return nil, fmt.Errorf("sealing record: %v", err)
+	}
+	return &envelope{WrappedKey: wrapped, Data: data}, nil
+}
+
+// open returns the JSON sealed in the envelope of the job with the given ID, or of its checkpoint.
+func (e *envelope) open(jobId string) ([]byte, error) {
+	dataKey, err := unseal(jobKey(jobId), e.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unsealing data key: %v", err)
+	}
+	recordJson, err := unseal(dataKey, e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("unsealing record: %v", err)
+	}
+	return recordJson, nil
+}
+
+// jobId returns the ID of the unfinished job in the envelope, or "" if it is finished.
+func (e *envelope) jobId() (string, error) {
+	return openJobId(e.SealedId)
+}
+
+// errNoCredentialsKey is returned when an unfinished job is saved without a credentialsKey.
+var errNoCredentialsKey = errors.New("no credentials key is configured to seal the job's ID")
+
+// unfinishedId returns the ID of an unfinished job sealed with credentialsKey, or nil if the job is finished.
+func unfinishedId(job *types.Job) ([]byte, error) {
+	if job.Finished() {
+		return nil, nil
+	}
+	if credentialsKey == nil {
+		return nil, errNoCredentialsKey
+	}
+	sealedId, err := seal(credentialsKey, []byte(job.JobId))
+	if err != nil {
+		return nil, fmt.Errorf("sealing job ID: %v", err)
+	}
+	return sealedId, nil
+}
+
+// openJobId reverses unfinishedId.
+func openJobId(sealedId []byte) (string, error) {
+	if sealedId == nil {
+		return "", nil
+	}
+	if credentialsKey == nil {
+		return "", errors.New("the job ID is sealed, but no credentials key is configured")
+	}
+	plain, err := unseal(credentialsKey, sealedId)
+	if err != nil {
+		return "", fmt.Errorf("unsealing job ID: %v", err)
+	}
+	return string(plain), nil
+}
+
+// sealJob returns the envelope in which to store the job.
+func sealJob(job *types.Job, jobJson []byte) ([]byte, error) {
+	env, err := sealRecord(job.JobId, jobJson)
+	if err != nil {
+		return nil, err
+	}
+	env.Owner, env.Updated, env.Finished = job.Owner, updated(job), job.Finished()
+	if env.SealedId, err = unfinishedId(job); err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// parseEnvelope parses a stored envelope, or returns nil for a record stored before jobs were encrypted.
+func parseEnvelope(stored []byte) (*envelope, error) {
+	env := &envelope{}
+	if err := json.Unmarshal(stored, env); err != nil {
+		return nil, err
+	}
+	if env.Data == nil {
+		return nil, nil
+	}
+	return env, nil
+}
+
+// openRecord returns the JSON of the job with the given ID, or of its checkpoint, from the stored envelope.
+func openRecord(jobId string, stored []byte) ([]byte, error) {
+	env, err := parseEnvelope(stored)
+	if err != nil {
+		return nil, err
+	}
+	if env == nil {
+		return nil, errors.New("record is not encrypted")
+	}
+	return env.open(jobId)
+}
+
+// encryptJobs is a migration that seals plain jobs, checkpoints, and users' job IDs, and moves them to storage keys.
+func encryptJobs(tx *bolt.Tx) (int, error) {
+	encrypted := 0
+	for _, name := range []string{"jobs", "checkpoints"} {
+		bucket := tx.Bucket([]byte(name))
+		if bucket == nil {
+			continue
+		}
+
+		plain := map[string][]byte{}
+		err := bucket.ForEach(func(k, v []byte) error {
+			if env, err := parseEnvelope(v); err == nil && env == nil {
+				plain[string(k)] = append([]byte(nil), v...)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for id, recordJson := range plain {
+			var stored []byte
+			if name == "jobs" {
+				job := &types.Job{}
+				if err := json.Unmarshal(recordJson, job); err != nil {
+					log.Warningf("DB contained job with id %q, but could not parse: %v", id, err)
+					continue
+				}
+				job.JobId = id
+				upgradeJob(job)
+				if recordJson, err = json.Marshal(job); err == nil {
+					stored, err = sealJob(job, recordJson)
+				}
+			} else {
+				var env *envelope
+				if env, err = sealRecord(id, recordJson); err == nil {
+					stored, err = json.Marshal(env)
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("encrypting %s record %q: %v", name, id, err)
+			}
+			if err := bucket.Put(jobStorageKey(id), stored); err != nil {
+				return 0, err
+			}
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return 0, err
+			}
+			encrypted++
+		}
+	}
+
+	users := tx.Bucket([]byte("users"))
+	if users == nil || credentialsKey == nil {
+		return encrypted, nil
+	}
+	plain := map[string]*User{}
+	err := users.ForEach(func(k, v []byte) error {
+		user := &User{}
+		if err := json.Unmarshal(v, user); err == nil && len(user.Jobs) > 0 {
+			plain[string(k)] = user
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for email, user := range plain {
+		userJson, err := marshalUser(user)
+		if err != nil {
+			return 0, fmt.Errorf("sealing jobs of user %q: %v", email, err)
+		}
+		if err := users.Put([]byte(email), userJson); err != nil {
+			return 0, err
+		}
+		encrypted++
+	}
+	return encrypted, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pdbogen/autopfs/types"
+	"testing"
+)
+
+// withCredentialsKey sets credentialsKey to key for the rest of the test; call the returned function to restore it.
+func withCredentialsKey(key []byte) func() {
+	old := credentialsKey
+	credentialsKey = key
+	return func() { credentialsKey = old }
+}
+
+func TestSealRecord(t *testing.T) {
+	const id = "0123456789abcdef"
+	recordJson := []byte(`{"ScenarioName":"The Confirmation"}`)
+
+	env, err := sealRecord(id, recordJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(env.Data, []byte("Confirmation")) {
+		t.Error("sealed record contains its plain text")
+	}
+	got, err := env.open(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, recordJson) {
+		t.Errorf("opened %q, want %q", got, recordJson)
+	}
+	if _, err := env.open("fedcba9876543210"); err == nil {
+		t.Error("opened with the wrong job ID")
+	}
+
+	env.Data[len(env.Data)-1] ^= 1
+	if _, err := env.open(id); err == nil {
+		t.Error("opened a record that was tampered with")
+	}
+}
+
+func TestJobStorageKey(t *testing.T) {
+	a, b := jobStorageKey("a"), jobStorageKey("b")
+	if !bytes.Equal(a, jobStorageKey("a")) {
+		t.Error("storage key is not stable")
+	}
+	if bytes.Equal(a, b) {
+		t.Error("different jobs have the same storage key")
+	}
+	if bytes.Equal(a, jobKey("a")) {
+		t.Error("storage key is the job's data key")
+	}
+}
+
+func TestUnfinishedId(t *testing.T) {
+	defer withCredentialsKey(bytes.Repeat([]byte{7}, 32))()
+
+	running := &types.Job{JobId: "running-job", State: "running"}
+	sealedId, err := unfinishedId(running)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealedId, []byte(running.JobId)) {
+		t.Error("sealed ID contains the ID")
+	}
+	if got, err := openJobId(sealedId); err != nil || got != running.JobId {
+		t.Errorf("opened %q, %v; want %q", got, err, running.JobId)
+	}
+
+	done := &types.Job{JobId: "done-job", State: types.JobStateDone}
+	if sealedId, err := unfinishedId(done); err != nil || sealedId != nil {
+		t.Errorf("finished job: got %v, %v; want nothing", sealedId, err)
+	}
+	if got, err := openJobId(nil); err != nil || got != "" {
+		t.Errorf("opened %q, %v for no ID", got, err)
+	}
+
+	otherKey := withCredentialsKey(bytes.Repeat([]byte{8}, 32))
+	if _, err := openJobId(sealedId); err == nil {
+		t.Error("opened an ID sealed with another key")
+	}
+	otherKey()
+}
+
+func TestUnfinishedIdWithoutKey(t *testing.T) {
+	defer withCredentialsKey(nil)()
+
+	running := &types.Job{JobId: "running-job", State: "running"}
+	if _, err := unfinishedId(running); err != errNoCredentialsKey {
+		t.Errorf("got %v, want %v", err, errNoCredentialsKey)
+	}
+	if _, err := sealJob(running, []byte("{}")); err != errNoCredentialsKey {
+		t.Errorf("sealing job: got %v, want %v", err, errNoCredentialsKey)
+	}
+	if _, err := openJobId([]byte("sealed")); err == nil {
+		t.Error("opened a sealed ID without a key")
+	}
+
+	// Finished jobs do not need their IDs stored, so they are saved without a key.
+	done := &types.Job{JobId: "done-job", State: types.JobStateDone}
+	if _, err := sealJob(done, []byte("{}")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSealJob(t *testing.T) {
+	defer withCredentialsKey(bytes.Repeat([]byte{7}, 32))()
+
+	job := &types.Job{JobId: "running-job", State: "running", Owner: "owner"}
+	jobJson, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := sealJob(job, jobJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte(job.JobId)) {
+		t.Error("stored job contains its ID")
+	}
+
+	env, err := parseEnvelope(stored)
+	if err != nil || env == nil {
+		t.Fatalf("parsing envelope: %v, %v", env, err)
+	}
+	if env.Owner != job.Owner || env.Finished {
+		t.Errorf("envelope has owner %q, finished %v", env.Owner, env.Finished)
+	}
+	if id, err := env.jobId(); err != nil || id != job.JobId {
+		t.Errorf("envelope has ID %q, %v; want %q", id, err, job.JobId)
+	}
+	got, err := openRecord(job.JobId, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, jobJson) {
+		t.Errorf("opened %s, want %s", got, jobJson)
+	}
+
+	// Records stored before jobs were encrypted are not envelopes.
+	if env, err := parseEnvelope(jobJson); err != nil || env != nil {
+		t.Errorf("plain job: got %v, %v; want nil", env, err)
+	}
+	if _, err := openRecord(job.JobId, jobJson); err == nil {
+		t.Error("opened a plain job")
+	}
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	bolt "github.com/coreos/bbolt"
 	"github.com/pdbogen/autopfs/paizo"
 	"github.com/pdbogen/autopfs/types"
-	"sort"
 	"sync"
 	"time"
 )
@@ -21,13 +19,16 @@ type Job struct {
 	types.Job
 	Subscriptions   []*JobMessageSubscription `json:"-"`
 	SubscriptionsMu *sync.Mutex               `json:"-"`
+	// cancelRequested is set by Queue.Cancel before it cancels a running job's context, so that the job can tell
+	// cancellation by the user from server shutdown.
+	cancelRequested bool
 }
 
-// Load loads a job from the given DB. If the job does not exist, both job and err will be nil. If anything else goes
-// wrong, job will be nil and err will be non-nil. If the job exists and is loaded properly, job will be non-nil and
-// err will be nil.
-func Load(db *bolt.DB, jobId string) (job *Job, err error) {
-	jobs, err := LoadMany(db, []string{jobId})
+// Load loads a job from the given store. If the job does not exist, both job and err will be nil. If anything else
+// goes wrong, job will be nil and err will be non-nil. If the job exists and is loaded properly, job will be non-nil
+// and err will be nil.
+func Load(store Store, jobId string) (job *Job, err error) {
+	jobs, err := LoadMany(store, []string{jobId})
 	if err != nil {
 		return nil, err
 	}
@@ -37,71 +38,81 @@ func Load(db *bolt.DB, jobId string) (job *Job, err error) {
 	return jobs[0], nil
 }
 
-// LoadMany loads and returns whichever named job IDs exist in the database.
+// LoadMany loads and returns whichever named job IDs exist in the store.
 // This means that jobs might well be empty. An error is returned only for
 // cases where there are DB issues. Unparseable jobs are treated as
-// nonexistent.
-func LoadMany(db *bolt.DB, jobIds []string) (jobs []*Job, err error) {
-	err = db.View(func(tx *bolt.Tx) error {
-		jobsBucket := tx.Bucket([]byte("jobs"))
-		if jobsBucket == nil {
-			return nil
-		}
-
-		for _, jobId := range jobIds {
-			jobJson := jobsBucket.Get([]byte(jobId))
-			if jobJson == nil {
-				continue
-			}
+// nonexistent; older jobs are upgraded.
+func LoadMany(store Store, jobIds []string) (jobs []*Job, err error) {
+	stored, err := store.LoadJobs(jobIds)
+	if err != nil {
+		return nil, err
+	}
 
-			job := &Job{
-				SubscriptionsMu: &sync.Mutex{},
-			}
-			if err := json.Unmarshal(jobJson, job); err != nil {
-				log.Warningf("DB contained job with id %q, but could not parse: %v", err)
-				continue
-			}
+	for _, storedJob := range stored {
+		job := &Job{
+			Job:             *storedJob,
+			SubscriptionsMu: &sync.Mutex{},
+		}
+		if !checkSchema(&job.Job) {
+			continue
+		}
 
-			for _, j := range job.Messages {
-				j.JobId = job.JobId
-			}
+		for _, j := range job.Messages {
+			j.JobId = job.JobId
+		}
 
-			for _, sess := range job.Sessions {
-				sort.Slice(sess.EventNumber, func(i, j int) bool {
-					return sess.EventNumber[i] < sess.EventNumber[j]
-				})
-				sort.Ints(sess.Character)
+		if upgradeJob(&job.Job) {
+			if err := job.Save(store); err != nil {
+				log.Warningf("saving upgraded job %q: %v", job.JobId, err)
 			}
-			jobs = append(jobs, job)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		jobs = append(jobs, job)
 	}
 	return jobs, nil
 }
 
-func (j *Job) Save(db *bolt.DB) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		jobs, err := tx.CreateBucketIfNotExists([]byte("jobs"))
-		if err != nil {
-			return fmt.Errorf("error opening jobs bucket: %v", err)
-		}
+// checkSchema returns true if the job was saved by this server or an older one; otherwise, it logs that the job cannot
+// be read.
+func checkSchema(job *types.Job) bool {
+	if job.Schema > jobSchema {
+		log.Warningf("DB contained job with id %q, but it has schema version %d, and this server only knows up to %d",
+			job.JobId, job.Schema, jobSchema)
+		return false
+	}
+	return true
+}
 
-		jsonBytes, err := json.Marshal(j)
+// SelectSessions returns the job and its sessions as types.Job.Select would, or nil; check the mode beforehand.
+func SelectSessions(store Store, jobId, mode string, filter types.Filter, order types.Order) (*Job, []*types.Session,
+	error) {
+	stored, sessions, err := store.QuerySessions(jobId, mode, filter, order)
+	if err != nil || stored == nil || !checkSchema(stored) {
+		return nil, nil, err
+	}
+	if stored.Schema < jobSchema {
+		job, err := Load(store, jobId)
+		if err != nil || job == nil {
+			return nil, nil, err
+		}
+		sessions, err := job.Select(mode, filter, order)
 		if err != nil {
-			return fmt.Errorf("error marshaling job to JSON: %v", err)
+			return nil, nil, err
 		}
+		return job, sessions, nil
+	}
+	return &Job{Job: *stored, SubscriptionsMu: &sync.Mutex{}}, sessions, nil
+}
 
-		if err := jobs.Put([]byte(j.JobId), jsonBytes); err != nil {
-			return fmt.Errorf("saving job to DB: %v", err)
-		}
-		return nil
-	})
+func (j *Job) Save(store Store) error {
+	j.Schema = jobSchema
+	if err := store.SaveJob(&j.Job); err != nil {
+		return fmt.Errorf("saving job %q: %v", j.JobId, err)
+	}
+	return nil
 }
 
-func (j *Job) UpdateStatus(db *bolt.DB, status string, msg string) error {
+// UpdateStatus adds a message to the job, and saves it and the job's state. Other changes to the job need Save.
+func (j *Job) UpdateStatus(store Store, status string, msg string) error {
 	j.State = status
 	jobMsg := &types.JobMessage{
 		JobId:   j.JobId,
@@ -111,82 +122,309 @@ func (j *Job) UpdateStatus(db *bolt.DB, status string, msg string) error {
 	}
 
 	j.Messages = append(j.Messages, jobMsg)
-	if err := j.Save(db); err != nil {
+	j.Schema = jobSchema
+	if err := store.AppendMessage(&j.Job, jobMsg); err != nil {
 		return fmt.Errorf("updating job %q status: %v", j.JobId, err)
 	}
 
-	Publish(jobMsg)
+	Publish(j.JobId, &types.JobFrame{Type: types.FrameMessage, Message: jobMsg})
 	return nil
 }
 
-func (j *Job) Run(db *bolt.DB, wg *sync.WaitGroup) {
+// publishCharacters sends each of the given characters to the job's subscribers, so that they can be shown before the
+// job is done.
+func (j *Job) publishCharacters(chars []types.Character) {
+	for i := range chars {
+		Publish(j.JobId, &types.JobFrame{Type: types.FrameCharacter, Character: &chars[i]})
+	}
+}
+
+// publishSessions sends each of the given sessions to the job's subscribers; e.g. for paizo.SessionOptions Page.
+func (j *Job) publishSessions(ps, gs []*types.Session) {
+	for _, sess := range append(append([]*types.Session(nil), ps...), gs...) {
+		Publish(j.JobId, &types.JobFrame{Type: types.FrameSession, Session: sess})
+	}
+}
+
+// Run runs or refreshes the job from src, continuing from any progress recorded in cp.
+// If ctx is cancelled, the job stops, and keeps its checkpoint unless the user cancelled it.
+func (j *Job) Run(ctx context.Context, store Store, wg *sync.WaitGroup, src Source, cp *Checkpoint) {
 	defer wg.Done()
-	if err := j.UpdateStatus(db, "login", "Logging in..."); err != nil {
+	if cp.Refresh {
+		j.refresh(ctx, store, src, cp)
+	} else {
+		j.run(ctx, store, src, cp)
+	}
+
+	if ctx.Err() == nil || j.Finished() {
+		j.clearCheckpoint(store)
+		return
+	}
+
+	if !j.cancelRequested {
+		if err := j.UpdateStatus(store, j.State, "Interrupted by a server restart; this job will continue when the "+
+			"server is back."); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	j.clearCheckpoint(store)
+	j.cancel(store, cp.Refresh)
+}
+
+// notifier returns a function that adds the given message to the job's messages, without changing its state; e.g. for
+// paizo.Options Notify.
+func (j *Job) notifier(store Store) func(msg string) {
+	return func(msg string) {
+		if err := j.UpdateStatus(store, j.State, msg); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// cancel marks the job cancelled. If it was being refreshed, it is returned to the done state, since it still has its
+// previous results.
+func (j *Job) cancel(store Store, refresh bool) {
+	if err := j.UpdateStatus(store, types.JobStateCancelled, "Cancelled."); err != nil {
+		log.Error(err)
+	}
+	if refresh {
+		if err := j.UpdateStatus(store, types.JobStateDone, "Refresh cancelled; keeping the previous results."); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// startCheckpoint saves the given checkpoint, sealing the job's credentials into it if they are needed and not
+// already. The checkpoint is removed when the job finishes or is cancelled; see Run.
+func (j *Job) startCheckpoint(store Store, cp *Checkpoint) {
+	if cp.Credentials == nil && cp.Import == nil {
+		sealed, err := sealCredentials(j.Email, j.Pass)
+		if err != nil {
+			log.Errorf("sealing credentials for job %q: %v", j.JobId, err)
+		}
+		cp.Credentials = sealed
+	}
+	if err := store.SaveCheckpoint(j.JobId, cp); err != nil {
+		log.Warningf("saving checkpoint for job %q: %v", j.JobId, err)
+	}
+}
+
+// checkpointer returns a paizo.SessionOptions Checkpoint function that saves progress on top of cp, which is not
+// modified.
+func (j *Job) checkpointer(store Store, cp *Checkpoint) func(string, []*types.Session, []*types.Session) {
+	return func(nextUrl string, ps, gs []*types.Session) {
+		next := *cp
+		next.PageUrl = nextUrl
+		next.Player = append(append([]*types.Session(nil), cp.Player...), ps...)
+		next.GM = append(append([]*types.Session(nil), cp.GM...), gs...)
+		if err := store.SaveCheckpoint(j.JobId, &next); err != nil {
+			log.Warningf("saving checkpoint for job %q: %v", j.JobId, err)
+		}
+	}
+}
+
+func (j *Job) clearCheckpoint(store Store) {
+	if err := store.DeleteCheckpoint(j.JobId); err != nil {
+		log.Warningf("removing checkpoint for job %q: %v", j.JobId, err)
+	}
+}
+
+// run and refresh return early, without updating the job's state, if ctx is cancelled; see Run.
+func (j *Job) run(ctx context.Context, store Store, src Source, cp *Checkpoint) {
+	if cp.PageUrl != "" {
+		if err := j.UpdateStatus(store, "login", "Resuming after a server restart; logging in..."); err != nil {
+			log.Error(err)
+		}
+	} else if err := j.UpdateStatus(store, "login", "Logging in..."); err != nil {
 		log.Error(err)
 	}
 
 	e, p := j.Email, j.Pass
 
-	paizoSession, err := paizo.Login(e, p)
+	err := src.Login(ctx, e, p)
 	if err != nil {
-		if err := j.UpdateStatus(db, "error", "error logging in to Paizo: "+err.Error()); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := j.UpdateStatus(store, types.JobStateError, "error logging in to "+src.Name()+": "+err.Error()); err != nil {
 			log.Error(err)
 		}
 		return
 	}
 
-	if err := j.UpdateStatus(db, "sessions", "Getting player sessions..."); err != nil {
+	if err := j.UpdateStatus(store, "sessions", "Getting player sessions..."); err != nil {
 		log.Error(err)
 	}
 
-	if err := j.UpdateStatus(db, "sessions", "Getting characters..."); err != nil {
+	if err := j.UpdateStatus(store, "sessions", "Getting characters..."); err != nil {
 		log.Error(err)
 	}
-	chars, err := paizoSession.GetCharacters()
+	chars, err := src.Characters(ctx)
+	if err == nil {
+		j.Characters = chars
+		if err := j.Save(store); err != nil {
+			log.Error(err)
+		}
+	}
 
-	if err := j.UpdateStatus(db, "sessions", fmt.Sprintf("Got %d characters.", len(chars))); err != nil {
+	if err := j.UpdateStatus(store, "sessions", fmt.Sprintf("Got %d characters.", len(chars))); err != nil {
 		log.Error(err)
 	}
 
 	if err != nil {
-		if err := j.UpdateStatus(db, "error", "fatal error getting characters: "+err.Error()); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := j.UpdateStatus(store, types.JobStateError, "fatal error getting characters: "+err.Error()); err != nil {
 			log.Errorf("updating job status: %q", err)
 		}
 		return
 	}
-	j.Characters = chars
+	j.publishCharacters(chars)
 
-	ps, gs, err := paizoSession.GetSessions(j.Characters, func(cur, total int) {
-		if err := j.UpdateStatus(db, "sessions",
-			fmt.Sprintf("Getting sessions (%d/%d)...", cur, total),
-		); err != nil {
-			log.Error(err)
-		}
+	resumed := len(cp.Player) + len(cp.GM)
+	ps, gs, err := src.Sessions(ctx, j.Characters, paizo.SessionOptions{
+		Progress: func(cur, total int) {
+			if err := j.UpdateStatus(store, "sessions",
+				fmt.Sprintf("Getting sessions (%d/%d)...", resumed+cur, total),
+			); err != nil {
+				log.Error(err)
+			}
+		},
+		StartUrl:   cp.PageUrl,
+		Checkpoint: j.checkpointer(store, cp),
+		Page:       j.publishSessions,
 	})
 
 	if err != nil {
 		log.Error("Getting sessions for job %q: %v", j.JobId, err)
 		if ps == nil {
-			if err := j.UpdateStatus(db, "error", "fatal error: "+err.Error()); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := j.UpdateStatus(store, types.JobStateError, "fatal error: "+err.Error()); err != nil {
 				log.Error(err)
 			}
 			return
 		}
-		if err := j.UpdateStatus(db, j.State, "minor errors while parsing sessions: "+err.Error()); err != nil {
+		if err := j.UpdateStatus(store, j.State, "minor errors while parsing sessions: "+err.Error()); err != nil {
 			log.Error(err)
 		}
 	}
+	ps = append(append([]*types.Session(nil), cp.Player...), ps...)
+	gs = append(append([]*types.Session(nil), cp.GM...), gs...)
 
-	if err := j.UpdateStatus(db, "player", fmt.Sprintf("Got %d unique player scenarios", len(ps))); err != nil {
+	if err := j.UpdateStatus(store, "player", fmt.Sprintf("Got %d unique player scenarios", len(types.DeDupe(ps)))); err != nil {
 		log.Error(err)
 	}
 
-	if err := j.UpdateStatus(db, "gm", fmt.Sprintf("Got %d unique GM scenarios", len(gs))); err != nil {
+	if err := j.UpdateStatus(store, "gm", fmt.Sprintf("Got %d unique GM scenarios", len(types.DeDupe(gs)))); err != nil {
 		log.Error(err)
 	}
 
-	j.Sessions = types.DeDupe(append(ps, gs...))
-	if err := j.UpdateStatus(db, types.JobStateDone, fmt.Sprintf("Done! %d total unique scenarios", len(j.Sessions))); err != nil {
+	// Imported sessions may already have been merged, in which case there are no plays to keep.
+	all := types.JobFromSessions(append(ps, gs...))
+	j.Plays, j.Sessions = all.Plays, all.Sessions
+	if err := j.Save(store); err != nil {
+		log.Warningf("saving completed job %q: %v", j.JobId, err)
+	}
+	if err := j.UpdateStatus(store, types.JobStateDone, fmt.Sprintf("Done! %d total unique scenarios", len(j.Sessions))); err != nil {
 		log.Warningf("saving completed job %q: %v", j.JobId, err)
 	}
 }
+
+// refresh fails by returning the job to the done state with its previous sessions.
+func (j *Job) refresh(ctx context.Context, store Store, src Source, cp *Checkpoint) {
+	fail := func(msg string) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := j.UpdateStatus(store, types.JobStateError, msg); err != nil {
+			log.Error(err)
+		}
+		if err := j.UpdateStatus(store, types.JobStateDone, "Refresh failed; keeping the previous results."); err != nil {
+			log.Error(err)
+		}
+	}
+
+	if cp.PageUrl != "" {
+		if err := j.UpdateStatus(store, "login", "Resuming refresh after a server restart; logging in..."); err != nil {
+			log.Error(err)
+		}
+	} else if err := j.UpdateStatus(store, "login", "Refreshing; logging in..."); err != nil {
+		log.Error(err)
+	}
+
+	if err := src.Login(ctx, j.Email, j.Pass); err != nil {
+		fail("error logging in to " + src.Name() + ": " + err.Error())
+		return
+	}
+
+	if err := j.UpdateStatus(store, "sessions", "Getting characters..."); err != nil {
+		log.Error(err)
+	}
+	chars, err := src.Characters(ctx)
+	if err != nil {
+		fail("fatal error getting characters: " + err.Error())
+		return
+	}
+	j.Characters = chars
+	if err := j.Save(store); err != nil {
+		log.Error(err)
+	}
+	j.publishCharacters(chars)
+
+	known := map[string][]*types.Session{}
+	for _, play := range j.AllPlays() {
+		known[play.ScenarioName] = append(known[play.ScenarioName], play)
+	}
+
+	resumed := len(cp.Player) + len(cp.GM)
+	ps, gs, err := src.Sessions(ctx, j.Characters, paizo.SessionOptions{
+		Known: func(sess *types.Session) bool {
+			for _, play := range known[sess.ScenarioName] {
+				if play.Covers(sess) {
+					return true
+				}
+			}
+			return false
+		},
+		Progress: func(cur, total int) {
+			if err := j.UpdateStatus(store, "sessions",
+				fmt.Sprintf("Getting new sessions (%d so far)...", resumed+cur),
+			); err != nil {
+				log.Error(err)
+			}
+		},
+		StartUrl:   cp.PageUrl,
+		Checkpoint: j.checkpointer(store, cp),
+		Page:       j.publishSessions,
+	})
+
+	if err != nil {
+		log.Errorf("Getting new sessions for job %q: %v", j.JobId, err)
+		if ps == nil {
+			fail("fatal error: " + err.Error())
+			return
+		}
+		if err := j.UpdateStatus(store, j.State, "minor errors while parsing sessions: "+err.Error()); err != nil {
+			log.Error(err)
+		}
+	}
+
+	added := append(append([]*types.Session(nil), cp.Player...), ps...)
+	added = append(append(added, cp.GM...), gs...)
+	if j.Plays != nil {
+		j.Plays = types.SortByDate(append(j.Plays, added...))
+	}
+	j.Sessions = types.DeDupe(append(added, j.Sessions...))
+	if err := j.Save(store); err != nil {
+		log.Warningf("saving refreshed job %q: %v", j.JobId, err)
+	}
+	if err := j.UpdateStatus(store, types.JobStateDone, fmt.Sprintf("Done! Found %d new sessions; %d total unique scenarios",
+		len(added), len(j.Sessions))); err != nil {
+		log.Warningf("saving refreshed job %q: %v", j.JobId, err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends email, such as sign-in links.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// logMailer logs the subject of each email instead of sending it.
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	log.Infof("Not sending email %q to %q, since no SMTP server is configured", subject, to)
+	return nil
+}
+
+// smtpMailer sends email with an SMTP server, authenticating with PLAIN auth if Username is set.
+type smtpMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("parsing SMTP address %q: %v", m.Addr, err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.Replace(body, "\n", "\r\n", -1)
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("sending email to %q: %v", to, err)
+	}
+	return nil
+}
@@ -8,23 +8,23 @@ import (
 	"flag"
 	"fmt"
 	"github.com/NYTimes/gziphandler"
-	bolt "github.com/coreos/bbolt"
 	"github.com/lpar/gzipped"
 	"github.com/op/go-logging"
 	log2 "github.com/pdbogen/autopfs/log"
 	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/paizo/fixture"
+	"github.com/pdbogen/autopfs/types"
 	"io"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"time"
 )
 
 var log = log2.Log
 
-func Csv(db *bolt.DB) func(rw http.ResponseWriter, req *http.Request) {
+func Csv(store Store) func(rw http.ResponseWriter, req *http.Request) {
 	return func(rw http.ResponseWriter, req *http.Request) {
 
 		if err := req.ParseForm(); err != nil {
@@ -38,13 +38,24 @@ func Csv(db *bolt.DB) func(rw http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		job, err := Load(db, id)
+		filter, order, err := parseSessionQuery(req.Form)
+		if err == nil {
+			err = types.CheckMode(req.FormValue("mode"))
+		}
+		if err != nil {
+			http.Error(rw, "Sorry, "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		job, sessions, err := SelectSessions(store, id, req.FormValue("mode"), filter, order)
 		if err != nil {
+			log.Errorf("selecting sessions of job %q: %v", id, err)
 			http.Error(rw, msgInternalServerError, http.StatusInternalServerError)
 			return
 		}
 		if job == nil {
 			http.NotFound(rw, req)
+			return
 		}
 
 		if !job.Done() {
@@ -60,7 +71,7 @@ func Csv(db *bolt.DB) func(rw http.ResponseWriter, req *http.Request) {
 
 		csvW.Write(paizo.CsvHeader)
 
-		for _, s := range job.Sessions {
+		for _, s := range sessions {
 			csvW.Write(s.Record())
 		}
 
@@ -100,9 +111,47 @@ func handleSignals(stop chan<- bool, sigs <-chan os.Signal) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		dbCommand(os.Args[2:])
+		return
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n       %s db inspect|repair [flags] [ID...]\n",
+			os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
 	port := flag.Int("port", 8080, "port to listen on for incoming connections")
-	dbPath := flag.String("db-path", "sessions.db", "path to the bolt DB used to persist completed jobs")
+	storeKind := flag.String("store", "bolt", "how to persist jobs: bolt, or sqlite to query them across jobs")
+	sqliteUnencrypted := flag.Bool("sqlite-unencrypted", false, "accept that -store sqlite does not encrypt jobs")
+	dbPath := flag.String("db-path", "sessions.db", "path to the bolt or SQLite DB used to persist jobs")
 	loglevel := flag.String("loglevel", "INFO", "set to DEBUG for more logging")
+	useFixture := flag.Bool("fixture", false, fmt.Sprintf("scrape a local server of recorded Paizo pages instead "+
+		"of paizo.com; sign in with %s / %s", fixture.Email, fixture.Password))
+	catalogPath := flag.String("catalog", "", "path to a JSON scenario catalog to use instead of the built-in one")
+	keyPath := flag.String("key-path", "autopfs.key", "path to the key that seals credentials and job IDs; required")
+	workers := flag.Int("workers", 2, "number of jobs to run at once")
+	queueSize := flag.Int("queue-size", 50, "number of jobs that may wait for a worker")
+	governor := paizo.NewGovernor()
+	flag.Float64Var(&governor.RequestsPerSecond, "paizo-rps", governor.RequestsPerSecond,
+		"most requests per second to Paizo; 0 for no limit")
+	flag.IntVar(&governor.Concurrency, "paizo-concurrency", governor.Concurrency,
+		"most concurrent Paizo requests per job; 0 for no limit")
+	flag.IntVar(&governor.MaxRetries, "paizo-retries", governor.MaxRetries, "times to retry a failed Paizo request")
+	flag.DurationVar(&governor.MinBackoff, "paizo-backoff", governor.MinBackoff, "delay before the first retry")
+	grace := flag.Duration("shutdown-grace", 30*time.Second, "how long to let running jobs finish on shutdown")
+	retention := Retention{}
+	flag.DurationVar(&retention.MaxAge, "retain-max-age", 0, "delete finished jobs this long after their last update")
+	flag.IntVar(&retention.MaxJobs, "retain-max-jobs", 0, "most finished jobs to keep; 0 for no limit")
+	flag.IntVar(&retention.PerOwner, "retain-per-owner", 0, "most finished jobs to keep per Paizo account")
+	janitorInterval := flag.Duration("janitor-interval", time.Hour, "how often to apply the -retain flags")
+	baseUrl := flag.String("base-url", "", "URL of this server, for links in emails; defaults to localhost:port")
+	smtp := smtpMailer{}
+	flag.StringVar(&smtp.Addr, "smtp-addr", "", "host:port of the SMTP server for sign-in links; none are sent if empty")
+	flag.StringVar(&smtp.From, "smtp-from", "autopfs@localhost", "address from which to send email")
+	flag.StringVar(&smtp.Username, "smtp-user", "", "username for the SMTP server, if any")
+	flag.StringVar(&smtp.Password, "smtp-password", "", "password for the SMTP server")
+	importPath := flag.String("import", "", "CSV or JSON export to import as a completed job, logging its URL")
 	flag.Parse()
 
 	lvl, err := logging.LogLevel(*loglevel)
@@ -111,28 +160,92 @@ func main() {
 	}
 	logging.SetLevel(lvl, log.Module)
 
-	db, err := bolt.Open(*dbPath, os.FileMode(0640), bolt.DefaultOptions)
+	if *catalogPath != "" {
+		cat, err := paizo.LoadCatalog(*catalogPath)
+		if err != nil {
+			log.Fatalf("loading scenario catalog: %s", err)
+		}
+		paizo.SetCatalog(cat)
+	}
+
+	paizoOpts := paizo.Options{Governor: governor}
+	if *useFixture {
+		srv := fixture.NewServer()
+		defer srv.Close()
+		paizoOpts.BaseUrl, paizoOpts.SecureUrl = srv.URL, srv.URL
+		log.Infof("Using Paizo fixture server at %s", srv.URL)
+	}
+
+	if *keyPath == "" {
+		log.Fatalf("-key-path is required")
+	}
+	if credentialsKey, err = loadCredentialsKey(*keyPath); err != nil {
+		log.Fatalf("loading credentials key: %s", err)
+	}
+
+	if *storeKind == "sqlite" {
+		if !*sqliteUnencrypted {
+			log.Fatalf("-store sqlite keeps players' sessions, characters, and job messages unencrypted; pass " +
+				"-sqlite-unencrypted to accept this, or use -store bolt")
+		}
+		log.Warningf("The SQLite store at %q keeps players' sessions, characters, and job messages UNENCRYPTED; "+
+			"anyone with a copy of it can read their play histories", *dbPath)
+	}
 
+	store, err := OpenStore(*storeKind, *dbPath)
 	if err != nil {
-		log.Fatalf("could not open bolt DB %q: %v", *dbPath, err)
+		log.Fatalf("opening store: %s", err)
 	}
 
 	stop := make(chan bool)
-	signals := make(chan os.Signal)
+	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, os.Kill)
 
 	go handleSignals(stop, signals)
 
-	jobsWg := &sync.WaitGroup{}
+	if *importPath != "" {
+		job, err := importFile(store, *importPath)
+		if err != nil {
+			log.Fatalf("importing: %s", err)
+		}
+		log.Infof("Imported %q; view it at /html?id=%s", *importPath, job.JobId)
+	}
 
-	http.HandleFunc("/", IndexController(db, JsHash, CssHash))
+	queue := NewQueue(store, paizoOpts, *workers, *queueSize)
+	if err := ResumeOrphans(store, queue); err != nil {
+		log.Errorf("resuming unfinished jobs: %s", err)
+	}
+
+	var mailer Mailer = logMailer{}
+	if smtp.Addr != "" {
+		mailer = &smtp
+	}
+	if *baseUrl == "" {
+		*baseUrl = fmt.Sprintf("http://localhost:%d", *port)
+	}
+
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	go retention.Janitor(janitorCtx, store, *janitorInterval)
+
+	http.HandleFunc("/", IndexController(store, JsHash, CssHash))
 	http.Handle("/static/", http.StripPrefix("/static/", gzipped.FileServer(assets)))
-	http.HandleFunc("/begin", Begin(db, jobsWg))
-	http.HandleFunc("/status", Status(db, JsHash, CssHash, false))
-	http.HandleFunc("/status/ws", Status(db, JsHash, CssHash, true))
-	http.HandleFunc("/csv", Csv(db))
-	http.HandleFunc("/html", Html(db, JsHash, CssHash))
-	http.Handle("/json", gziphandler.GzipHandler(http.HandlerFunc(GetJob(db))))
+	http.HandleFunc("/begin", Begin(store, queue))
+	http.HandleFunc("/import", Import(store, queue, JsHash, CssHash))
+	http.HandleFunc("/refresh", Refresh(store, queue, JsHash, CssHash))
+	http.HandleFunc("/cancel", Cancel(queue))
+	http.HandleFunc("/delete", Delete(store))
+	http.HandleFunc("/status", Status(store, JsHash, CssHash, false))
+	http.HandleFunc("/status/ws", Status(store, JsHash, CssHash, true))
+	http.HandleFunc("/csv", Csv(store))
+	http.HandleFunc("/html", Html(store, JsHash, CssHash))
+	http.Handle("/json", gziphandler.GzipHandler(http.HandlerFunc(GetJob(store))))
+	http.HandleFunc("/eligibility", Eligibility(store))
+	http.HandleFunc("/diff", Diff(store, JsHash, CssHash))
+	http.HandleFunc("/gaps", Gaps(store, JsHash, CssHash, false))
+	http.HandleFunc("/gaps/csv", Gaps(store, JsHash, CssHash, true))
+	http.HandleFunc("/account", Account(store, mailer, *baseUrl, JsHash, CssHash))
+	http.HandleFunc("/metrics", Metrics(store))
+	http.Handle(apiPrefix, gziphandler.GzipHandler(http.HandlerFunc(API(store, queue))))
 	server := http.Server{Addr: fmt.Sprintf(":%d", *port)}
 	go func() {
 		log.Infof("Starting up on port %d", *port)
@@ -144,6 +257,10 @@ func main() {
 	if err := server.Shutdown(context.Background()); err != nil {
 		log.Errorf("during shutdown: %s", err)
 	}
-	jobsWg.Wait()
+	stopJanitor()
+	queue.Close(*grace)
+	if err := store.Close(); err != nil {
+		log.Errorf("closing store: %s", err)
+	}
 	log.Infof("Shutdown complete. Bye!")
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+	"os"
+	"sort"
+)
+
+// A migration upgrades the DB to the next schema version, and returns how many records it changed.
+type migration struct {
+	Description string
+	Migrate     func(tx *bolt.Tx) (int, error)
+}
+
+// migrations are applied in order by Migrate, up from the DB's schema version; only ever append to them.
+var migrations = []migration{
+	{"encrypt jobs and checkpoints, and seal the job IDs of users", encryptJobs},
+}
+
+// jobUpgrades upgrade a job from the schema version of their index to the next, as it is loaded.
+var jobUpgrades = []func(job *types.Job){
+	// 0 to 1: sort each session's event numbers and characters.
+	func(job *types.Job) {
+		for _, sess := range job.Sessions {
+			sort.Slice(sess.EventNumber, func(i, j int) bool {
+				return sess.EventNumber[i] < sess.EventNumber[j]
+			})
+			sort.Ints(sess.Character)
+		}
+	},
+	// 1 to 2: rename sessions found by a catalog alias to the catalog's name, as ParseName now does.
+	func(job *types.Job) {
+		cat := paizo.CurrentCatalog()
+		for _, sess := range append(append([]*types.Session(nil), job.Sessions...), job.Plays...) {
+			if entry := cat.Lookup(sess.ScenarioName); entry != nil {
+				sess.Game, sess.Season, sess.Number, sess.Type = entry.Game, entry.Season, entry.Number, entry.Type
+				sess.ScenarioName = entry.Name
+			}
+		}
+		if job.Sessions != nil {
+			job.Sessions = types.DeDupe(job.Sessions)
+		}
+	},
+}
+
+// jobSchema is the schema version of jobs saved by this server.
+var jobSchema = len(jobUpgrades)
+
+var schemaKey = []byte("schema")
+
+// upgradeJob upgrades the job to jobSchema, and returns true if it was changed.
+func upgradeJob(job *types.Job) bool {
+	if job.Schema >= jobSchema {
+		return false
+	}
+	for _, upgrade := range jobUpgrades[job.Schema:] {
+		upgrade(job)
+	}
+	job.Schema = jobSchema
+	return true
+}
+
+// dbSchema returns the DB's schema version; see migrations.
+func dbSchema(tx *bolt.Tx) int {
+	meta := tx.Bucket([]byte("meta"))
+	if meta == nil {
+		return 0
+	}
+	version := meta.Get(schemaKey)
+	if len(version) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(version))
+}
+
+func setDbSchema(tx *bolt.Tx, version int) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+	if err != nil {
+		return fmt.Errorf("error opening meta bucket: %v", err)
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+	return meta.Put(schemaKey, buf)
+}
+
+// Migrate applies the migrations that the DB has not had, and returns how many records they changed.
+func Migrate(db *bolt.DB) (int, error) {
+	var version int
+	if err := db.View(func(tx *bolt.Tx) error {
+		version = dbSchema(tx)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("the DB has schema version %d, but this server only knows up to %d", version,
+			len(migrations))
+	}
+
+	changed := 0
+	for i, m := range migrations[version:] {
+		version := version + i + 1
+		n := 0
+		err := db.Update(func(tx *bolt.Tx) (err error) {
+			if n, err = m.Migrate(tx); err != nil {
+				return err
+			}
+			return setDbSchema(tx, version)
+		})
+		if err != nil {
+			return changed, fmt.Errorf("migrating the DB to schema version %d (%s): %v", version, m.Description, err)
+		}
+		log.Infof("Migrated the DB to schema version %d (%s), changing %d records", version, m.Description, n)
+		changed += n
+	}
+	return changed, nil
+}
+
+// compactDB rewrites the bolt DB at path, leaving no old records in its free pages.
+func compactDB(path string, mode os.FileMode) error {
+	src, err := bolt.Open(path, mode, bolt.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".compact"
+	dst, err := bolt.Open(tmpPath, mode, bolt.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+				copyBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyInto(copyBucket, bucket)
+			})
+		})
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("copying %q: %v", path, err)
+	}
+	if err := src.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// copyInto copies the keys of src, and its nested buckets, into dst.
+func copyInto(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyInto(nested, src.Bucket(k))
+	})
+}
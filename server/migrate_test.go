@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pdbogen/autopfs/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpgradeJob(t *testing.T) {
+	job := &types.Job{Sessions: []*types.Session{
+		{EventNumber: []int64{30, 10, 20}, Character: []int{2, -1, 1}},
+	}}
+	if !upgradeJob(job) {
+		t.Fatal("schema 0 job was not upgraded")
+	}
+	if job.Schema != jobSchema {
+		t.Errorf("upgraded to schema %d, want %d", job.Schema, jobSchema)
+	}
+	if got := jsonString(job.Sessions[0].EventNumber); got != "[10,20,30]" {
+		t.Errorf("event numbers %s", got)
+	}
+	if got := jsonString(job.Sessions[0].Character); got != "[-1,1,2]" {
+		t.Errorf("characters %s", got)
+	}
+	if upgradeJob(job) {
+		t.Error("current job was upgraded again")
+	}
+
+	newer := &types.Job{Schema: jobSchema + 1}
+	if upgradeJob(newer) || newer.Schema != jobSchema+1 {
+		t.Error("job from a newer server was upgraded")
+	}
+}
+
+func TestUpgradeJobAliases(t *testing.T) {
+	const (
+		alias = "Starfinder Society Roleplaying Guild Special #1-00: Claim to Salvation"
+		name  = "Starfinder Society Special #1-00: Claim to Salvation"
+	)
+	// Before aliases were renamed, a refresh added the same play again under the catalog's name.
+	aliased := &types.Session{ScenarioName: alias, Season: -1, EventNumber: []int64{10}, Character: []int{701},
+		Player: true}
+	renamed := &types.Session{ScenarioName: name, Game: "Starfinder", Season: 1, Type: types.TypeSpecial,
+		EventNumber: []int64{20}, Character: []int{702}, Player: true}
+	job := &types.Job{Schema: 1, Sessions: []*types.Session{aliased, renamed}, Plays: []*types.Session{aliased}}
+	upgradeJob(job)
+
+	if len(job.Sessions) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(job.Sessions))
+	}
+	got := job.Sessions[0]
+	if got.ScenarioName != name || got.Game != "Starfinder" || got.Season != 1 || got.Number != 0 ||
+		jsonString(got.Character) != "[701,702]" {
+		t.Errorf("merged session %s", jsonString(got))
+	}
+	if job.Plays[0].ScenarioName != name {
+		t.Errorf("play is named %q, want %q", job.Plays[0].ScenarioName, name)
+	}
+
+	imported := &types.Job{Schema: 1}
+	if upgradeJob(imported); imported.Sessions != nil {
+		t.Error("job without merged sessions was given some")
+	}
+}
+
+// jsonString returns v as JSON, or the error marshaling it.
+func jsonString(v interface{}) string {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(js)
+}
+
+// writeLegacyDb writes the given records, by bucket and key, to a new bolt DB at path, as a server from before
+// migrations would have.
+func writeLegacyDb(t *testing.T, path string, records map[string]map[string]interface{}) {
+	db, err := bolt.Open(path, os.FileMode(0640), bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		for name, bucketRecords := range records {
+			bucket, err := tx.CreateBucket([]byte(name))
+			if err != nil {
+				return err
+			}
+			for k, v := range bucketRecords {
+				js, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put([]byte(k), js); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	defer withCredentialsKey(bytes.Repeat([]byte{7}, 32))()
+	dir, err := ioutil.TempDir("", "autopfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.db")
+
+	writeLegacyDb(t, path, map[string]map[string]interface{}{
+		"jobs": {
+			"finished-job": &types.Job{State: types.JobStateDone, Sessions: []*types.Session{
+				{ScenarioName: "The Confirmation", EventNumber: []int64{20, 10}, Character: []int{2, 1}},
+			}},
+			"running-job": &types.Job{State: "scraping"},
+			"broken-job":  "not a job",
+		},
+		"checkpoints": {"running-job": &Checkpoint{PageUrl: "https://example.com/next"}},
+		"users":       {"a@example.com": &User{Email: "a@example.com", Jobs: []string{"finished-job"}}},
+	})
+
+	store, err := openBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		if version := dbSchema(tx); version != len(migrations) {
+			t.Errorf("DB has schema %d, want %d", version, len(migrations))
+		}
+		for _, name := range []string{"jobs", "checkpoints", "users"} {
+			tx.Bucket([]byte(name)).ForEach(func(k, v []byte) error {
+				for _, id := range []string{"finished-job", "running-job"} {
+					if bytes.Contains(k, []byte(id)) || bytes.Contains(v, []byte(id)) {
+						t.Errorf("%s record %q contains job ID %q", name, k, id)
+					}
+				}
+				if bytes.Contains(v, []byte("Confirmation")) || bytes.Contains(v, []byte("example.com/next")) {
+					t.Errorf("%s record %q is not encrypted", name, k)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := store.LoadJobs([]string{"finished-job", "running-job", "broken-job"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("loaded %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].Schema != jobSchema || jsonString(jobs[0].Sessions[0].EventNumber) != "[10,20]" {
+		t.Errorf("finished job was not upgraded: schema %d, events %v", jobs[0].Schema,
+			jobs[0].Sessions[0].EventNumber)
+	}
+
+	summaries, err := store.ListJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, summary := range summaries {
+		ids[summary.Id] = true
+	}
+	if !ids["running-job"] || ids["finished-job"] {
+		t.Errorf("listed IDs %v; want only the unfinished job's", ids)
+	}
+
+	cp, err := store.LoadCheckpoint("running-job")
+	if err != nil || cp == nil || cp.PageUrl != "https://example.com/next" {
+		t.Errorf("got checkpoint %+v, %v", cp, err)
+	}
+	user, err := store.LoadUser("a@example.com")
+	if err != nil || user == nil || len(user.Jobs) != 1 || user.Jobs[0] != "finished-job" {
+		t.Errorf("got user %+v, %v", user, err)
+	}
+
+	if n, err := Migrate(store.db); n != 0 || err != nil {
+		t.Errorf("migrating again changed %d records, %v", n, err)
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return setDbSchema(tx, len(migrations)+1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(store.db); err == nil {
+		t.Error("migrated a DB from a newer server")
+	}
+}
@@ -5,31 +5,51 @@ import (
 	"sync"
 )
 
+// subscriptionBuffer is how many frames a subscriber may fall behind before Publish drops it.
+const subscriptionBuffer = 256
+
 type Subscription struct {
 	JobId string
 	Id    int
-	Chan  chan *types.JobMessage
+	Chan  chan *types.JobFrame
+	// Dropped is closed if Publish drops the subscription for falling behind; nothing more is sent to Chan after.
+	Dropped chan struct{}
 }
 
 var Subscriptions = map[string][]Subscription{}
-var SubscriptionsMu = &sync.RWMutex{}
+var SubscriptionsMu = &sync.Mutex{}
 
-func Publish(jm *types.JobMessage) {
-	SubscriptionsMu.RLock()
-	defer SubscriptionsMu.RUnlock()
-	for _, sub := range Subscriptions[jm.JobId] {
-		go func() { sub.Chan <- jm }()
+// Publish sends the frame to each subscriber of the job, in order and without blocking.
+func Publish(jobId string, frame *types.JobFrame) {
+	SubscriptionsMu.Lock()
+	defer SubscriptionsMu.Unlock()
+	kept := []Subscription{}
+	for _, sub := range Subscriptions[jobId] {
+		select {
+		case sub.Chan <- frame:
+			kept = append(kept, sub)
+		default:
+			close(sub.Dropped)
+		}
+	}
+	if len(kept) == 0 {
+		delete(Subscriptions, jobId)
+		return
 	}
+	Subscriptions[jobId] = kept
 }
 
 func Subscribe(jobId string) Subscription {
 	SubscriptionsMu.Lock()
 	defer SubscriptionsMu.Unlock()
 
-	ch := make(chan *types.JobMessage)
-	newSub := Subscription{JobId: jobId, Chan: ch}
+	newSub := Subscription{
+		JobId:   jobId,
+		Chan:    make(chan *types.JobFrame, subscriptionBuffer),
+		Dropped: make(chan struct{}),
+	}
 	for _, sub := range Subscriptions[jobId] {
-		if sub.Id > newSub.Id {
+		if sub.Id >= newSub.Id {
 			newSub.Id = sub.Id + 1
 		}
 	}
@@ -39,13 +59,16 @@ func Subscribe(jobId string) Subscription {
 	return newSub
 }
 
+// Unsubscribe stops sending frames to the subscription. Chan is left open, since Publish may be sending to it.
 func (s Subscription) Unsubscribe() {
 	SubscriptionsMu.Lock()
 	defer SubscriptionsMu.Unlock()
 	for i, sub := range Subscriptions[s.JobId] {
-		if s.Id == sub.Id {
-			close(s.Chan)
+		if s.Chan == sub.Chan {
 			Subscriptions[s.JobId] = append(Subscriptions[s.JobId][:i], Subscriptions[s.JobId][i+1:]...)
+			if len(Subscriptions[s.JobId]) == 0 {
+				delete(Subscriptions, s.JobId)
+			}
 			return
 		}
 	}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/pdbogen/autopfs/types"
+	"sync"
+	"testing"
+)
+
+// newFrame returns a new frame; frames are told apart by their addresses.
+func newFrame() *types.JobFrame {
+	return &types.JobFrame{Type: types.FrameMessage, Message: &types.JobMessage{}}
+}
+
+func TestPublishUnsubscribe(t *testing.T) {
+	const jobId = "pubsub-job"
+	frames := []*types.JobFrame{}
+	for i := 0; i < 1000; i++ {
+		frames = append(frames, newFrame())
+	}
+
+	// Unsubscribing while a burst is published must not panic, and what was received must be in order.
+	for run := 0; run < 20; run++ {
+		sub := Subscribe(jobId)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, frame := range frames {
+				Publish(jobId, frame)
+			}
+		}()
+
+		next := 0
+	read:
+		for next < run*10 {
+			select {
+			case frame := <-sub.Chan:
+				if frame != frames[next] {
+					t.Fatalf("run %d: frame %d out of order", run, next)
+				}
+				next++
+			case <-sub.Dropped:
+				break read
+			}
+		}
+		sub.Unsubscribe()
+		wg.Wait()
+	}
+	if len(Subscriptions[jobId]) != 0 {
+		t.Errorf("%d subscriptions left", len(Subscriptions[jobId]))
+	}
+}
+
+func TestPublishDropsSlowSubscriber(t *testing.T) {
+	const jobId = "slow-job"
+	slow, fast := Subscribe(jobId), Subscribe(jobId)
+	defer slow.Unsubscribe()
+	defer fast.Unsubscribe()
+
+	frames := []*types.JobFrame{}
+	for i := 0; i <= subscriptionBuffer; i++ {
+		frames = append(frames, newFrame())
+		Publish(jobId, frames[i])
+		if i%2 == 0 {
+			if got := <-fast.Chan; got != frames[i/2] {
+				t.Fatalf("fast subscriber got frame out of order at %d", i/2)
+			}
+		}
+	}
+
+	select {
+	case <-slow.Dropped:
+	default:
+		t.Fatal("slow subscriber was not dropped")
+	}
+	select {
+	case <-fast.Dropped:
+		t.Fatal("fast subscriber was dropped")
+	default:
+	}
+	for i := 0; i < subscriptionBuffer; i++ {
+		if got := <-slow.Chan; got != frames[i] {
+			t.Fatalf("slow subscriber got frame out of order at %d", i)
+		}
+	}
+	if len(Subscriptions[jobId]) != 1 {
+		t.Errorf("got %d subscriptions, want 1", len(Subscriptions[jobId]))
+	}
+
+	// Unsubscribing after being dropped leaves other subscriptions alone.
+	slow.Unsubscribe()
+	if len(Subscriptions[jobId]) != 1 {
+		t.Errorf("got %d subscriptions after unsubscribing the dropped one, want 1", len(Subscriptions[jobId]))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pdbogen/autopfs/types"
+	"html/template"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// queryDate is the format of the `from` and `to` parameters.
+const queryDate = "2006-01-02"
+
+// queryParams are the parameters read by parseSessionQuery.
+var queryParams = []string{"game", "season", "character", "role", "from", "to", "name", "sort", "order"}
+
+// parseSessionQuery reads the filter and order with which to list a job's sessions from the given parameters:
+//
+//	game       the game, e.g. Pathfinder2
+//	season     the season number
+//	character  a character number, played or GMed
+//	role       player or gm
+//	from, to   the first and last dates, as YYYY-MM-DD
+//	name       part of the scenario name
+//	sort       one of the types.Sort* keys
+//	order      asc (the default) or desc
+//
+// Each is optional.
+func parseSessionQuery(values url.Values) (filter types.Filter, order types.Order, err error) {
+	filter.Game = values.Get("game")
+	filter.Name = values.Get("name")
+
+	if season := values.Get("season"); season != "" {
+		n, err := strconv.Atoi(season)
+		if err != nil {
+			return filter, order, fmt.Errorf("season must be a number")
+		}
+		filter.Season = &n
+	}
+
+	if character := values.Get("character"); character != "" {
+		if filter.Character, err = strconv.Atoi(character); err != nil {
+			return filter, order, fmt.Errorf("character must be a number")
+		}
+	}
+
+	switch filter.Role = values.Get("role"); filter.Role {
+	case "", types.RolePlayer, types.RoleGM:
+	default:
+		return filter, order, fmt.Errorf("role must be %s or %s", types.RolePlayer, types.RoleGM)
+	}
+
+	if from := values.Get("from"); from != "" {
+		if filter.From, err = time.Parse(queryDate, from); err != nil {
+			return filter, order, fmt.Errorf("from must be a date, like %s", queryDate)
+		}
+	}
+	if to := values.Get("to"); to != "" {
+		if filter.To, err = time.Parse(queryDate, to); err != nil {
+			return filter, order, fmt.Errorf("to must be a date, like %s", queryDate)
+		}
+		// The last day is included.
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+
+	order.Key = values.Get("sort")
+	if err := order.Check(); err != nil {
+		return filter, order, err
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		order.Descending = true
+	default:
+		return filter, order, fmt.Errorf("order must be asc or desc")
+	}
+
+	return filter, order, nil
+}
+
+// sessionQuery returns the query string for the job and mode, with the parseSessionQuery parameters from values.
+func sessionQuery(id, mode string, values url.Values) string {
+	query := url.Values{"id": {id}}
+	if mode != "" {
+		query.Set("mode", mode)
+	}
+	for _, param := range queryParams {
+		if value := values.Get(param); value != "" {
+			query.Set(param, value)
+		}
+	}
+	return query.Encode()
+}
+
+// queryFilterLabels describe the filtering parameters, in the order activeFilters lists them.
+var queryFilterLabels = []struct{ Param, Label string }{
+	{"game", "Game"},
+	{"season", "Season"},
+	{"character", "Character"},
+	{"role", "Played or GMed"},
+	{"from", "From"},
+	{"to", "To"},
+	{"name", "Name contains"},
+}
+
+// activeFilter is a filtering parameter in use, as listed by the HTML view.
+type activeFilter struct {
+	Label string
+	Value string
+	// Without is the query string for the same view without this filter.
+	Without template.URL
+}
+
+// activeFilters lists the filtering parameters in values.
+func activeFilters(id, mode string, values url.Values) []activeFilter {
+	ret := []activeFilter{}
+	for _, filter := range queryFilterLabels {
+		value := values.Get(filter.Param)
+		if value == "" {
+			continue
+		}
+		without := url.Values{}
+		for k, v := range values {
+			without[k] = v
+		}
+		without.Del(filter.Param)
+		ret = append(ret, activeFilter{Label: filter.Label, Value: value, Without: template.URL(sessionQuery(id, mode, without))})
+	}
+	return ret
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/pdbogen/autopfs/types"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSessionQuery(t *testing.T) {
+	five := 5
+	cases := []struct {
+		Query  string
+		Filter types.Filter
+		Order  types.Order
+		Err    bool
+	}{
+		{Query: ""},
+		{
+			Query: "game=Pathfinder2&season=5&character=2001&role=gm&name=Absalom&sort=date&order=desc",
+			Filter: types.Filter{Game: "Pathfinder2", Season: &five, Character: 2001, Role: types.RoleGM,
+				Name: "Absalom"},
+			Order: types.Order{Key: types.SortDate, Descending: true},
+		},
+		{
+			// the last day is included
+			Query: "from=2018-01-01&to=2018-12-31",
+			Filter: types.Filter{
+				From: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{Query: "sort=name&order=asc", Order: types.Order{Key: types.SortName}},
+		{Query: "season=five", Err: true},
+		{Query: "character=Valeros", Err: true},
+		{Query: "role=both", Err: true},
+		{Query: "from=01/01/2018", Err: true},
+		{Query: "to=yesterday", Err: true},
+		{Query: "sort=fun", Err: true},
+		{Query: "order=up", Err: true},
+	}
+	for _, tc := range cases {
+		values, err := url.ParseQuery(tc.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter, order, err := parseSessionQuery(values)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("%q: got no error", tc.Query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.Query, err)
+			continue
+		}
+		if !reflect.DeepEqual(filter, tc.Filter) {
+			t.Errorf("%q: got filter %+v, want %+v", tc.Query, filter, tc.Filter)
+		}
+		if order != tc.Order {
+			t.Errorf("%q: got order %+v, want %+v", tc.Query, order, tc.Order)
+		}
+	}
+}
+
+func TestSessionQuery(t *testing.T) {
+	values := url.Values{"season": {"5"}, "sort": {"date"}, "id": {"other"}, "unknown": {"x"}}
+	if got, want := sessionQuery("job", "plays", values), "id=job&mode=plays&season=5&sort=date"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/pdbogen/autopfs/paizo"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by Queue.Add when there are already as many jobs waiting as the queue allows.
+var ErrQueueFull = errors.New("the job queue is full")
+
+// ErrAlreadyQueued is returned by Queue.Add when another job for the same email address is waiting or running.
+var ErrAlreadyQueued = errors.New("a job for that account is already waiting or running")
+
+type queuedJob struct {
+	job   *Job
+	cp    *Checkpoint
+	email string
+	// left is set once the job starts or is cancelled, after which announce leaves its status alone.
+	left   bool
+	leftMu sync.Mutex
+}
+
+// leave marks the job as no longer waiting, once any announce of its place has been saved.
+func (queued *queuedJob) leave() {
+	queued.leftMu.Lock()
+	queued.left = true
+	queued.leftMu.Unlock()
+}
+
+// queuedAccount is the waiting or running job for one email address, and a hash of its credentials.
+type queuedAccount struct {
+	jobId       string
+	credentials [sha256.Size]byte
+}
+
+func hashCredentials(email, pass string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(email + "\x00" + pass))
+}
+
+// Queue runs jobs in order on a fixed number of workers, one at a time per Paizo email address.
+type Queue struct {
+	store     Store
+	paizoOpts paizo.Options
+	maxWait   int
+
+	// ctx is the parent of every running job's context, and is cancelled by Close.
+	ctx  context.Context
+	stop context.CancelFunc
+
+	wg      *sync.WaitGroup
+	mu      *sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	waiting []*queuedJob
+	// running holds the cancel functions of running jobs, by job ID.
+	running map[string]func()
+	// byEmail and byJob hold each waiting or running job, by normalized email address and by job ID.
+	byEmail map[string]queuedAccount
+	byJob   map[string]bool
+}
+
+// NewQueue starts and returns a Queue running up to `workers` jobs at once, with up to `maxWait` more waiting.
+func NewQueue(store Store, paizoOpts paizo.Options, workers, maxWait int) *Queue {
+	mu := &sync.Mutex{}
+	ctx, stop := context.WithCancel(context.Background())
+	q := &Queue{
+		ctx:       ctx,
+		stop:      stop,
+		running:   map[string]func(){},
+		store:     store,
+		paizoOpts: paizoOpts,
+		maxWait:   maxWait,
+		wg:        &sync.WaitGroup{},
+		mu:        mu,
+		cond:      sync.NewCond(mu),
+		byEmail:   map[string]queuedAccount{},
+		byJob:     map[string]bool{},
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Add saves the checkpoint cp for the job and adds the job to the end of the queue. If the same job, or one with the
+// same credentials, is already queued, its ID is returned instead.
+func (q *Queue) Add(job *Job, cp *Checkpoint) (existingId string, err error) {
+	email := strings.ToLower(strings.TrimSpace(job.Email))
+	credentials := hashCredentials(email, job.Pass)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if queued, ok := q.byEmail[email]; ok {
+		if subtle.ConstantTimeCompare(queued.credentials[:], credentials[:]) != 1 {
+			return "", ErrAlreadyQueued
+		}
+		return queued.jobId, nil
+	}
+	if q.byJob[job.JobId] {
+		return job.JobId, nil
+	}
+	if q.closed || len(q.waiting) >= q.maxWait {
+		return "", ErrQueueFull
+	}
+
+	job.startCheckpoint(q.store, cp)
+	q.waiting = append(q.waiting, &queuedJob{job: job, cp: cp, email: email})
+	if email != "" {
+		q.byEmail[email] = queuedAccount{jobId: job.JobId, credentials: credentials}
+	}
+	q.byJob[job.JobId] = true
+	if err := job.UpdateStatus(q.store, "queued", q.position(len(q.waiting))); err != nil {
+		log.Error(err)
+	}
+	q.cond.Signal()
+	return "", nil
+}
+
+// Cancel cancels the job with the given ID, whether it is waiting or running. It returns false if the job is neither.
+func (q *Queue) Cancel(jobId string) bool {
+	q.mu.Lock()
+	if cancel, ok := q.running[jobId]; ok {
+		cancel()
+		q.mu.Unlock()
+		return true
+	}
+
+	for i, queued := range q.waiting {
+		if queued.job.JobId != jobId {
+			continue
+		}
+		q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+		delete(q.byEmail, queued.email)
+		delete(q.byJob, jobId)
+		behind := q.waitingFrom(i)
+		q.mu.Unlock()
+
+		queued.leave()
+		queued.job.clearCheckpoint(q.store)
+		queued.job.cancel(q.store, queued.cp.Refresh)
+		q.announce(behind, i)
+		return true
+	}
+	q.mu.Unlock()
+	return false
+}
+
+// Close stops the queue from starting jobs, and waits up to `grace` for running jobs before cancelling them.
+func (q *Queue) Close(grace time.Duration) {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		log.Warningf("Jobs still running after %s; cancelling them", grace)
+		q.stop()
+		<-done
+	}
+	q.stop()
+}
+
+// source returns the Source from which the job should get its data: the imported data in cp, if any, or else Paizo.
+func (q *Queue) source(job *Job, cp *Checkpoint) Source {
+	if cp.Import != nil {
+		return &importSource{job: cp.Import}
+	}
+	opts := q.paizoOpts
+	opts.Notify = job.notifier(q.store)
+	return &paizoSource{opts: opts}
+}
+
+// waitingFrom returns the waiting jobs from the given index on, for announce. q.mu must be held.
+func (q *Queue) waitingFrom(from int) []*queuedJob {
+	return append([]*queuedJob(nil), q.waiting[from:]...)
+}
+
+// announce tells each of the given jobs, starting at index `from`, its place in line; q.mu must not be held.
+func (q *Queue) announce(jobs []*queuedJob, from int) {
+	for i, queued := range jobs {
+		queued.leftMu.Lock()
+		if !queued.left {
+			if err := queued.job.UpdateStatus(q.store, "queued", q.position(from+i+1)); err != nil {
+				log.Error(err)
+			}
+		}
+		queued.leftMu.Unlock()
+	}
+}
+
+func (q *Queue) position(n int) string {
+	if n == 1 {
+		return "Waiting to start; you are next in line."
+	}
+	return fmt.Sprintf("Waiting to start; you are #%d in line.", n)
+}
+
+func (q *Queue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.waiting) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		behind := q.waitingFrom(0)
+		ctx, cancel := context.WithCancel(q.ctx)
+		q.running[next.job.JobId] = func() {
+			next.job.cancelRequested = true
+			cancel()
+		}
+		q.wg.Add(1)
+		q.mu.Unlock()
+
+		next.leave()
+		q.announce(behind, 0)
+
+		next.job.Run(ctx, q.store, q.wg, q.source(next.job, next.cp), next.cp)
+		cancel()
+
+		q.mu.Lock()
+		delete(q.running, next.job.JobId)
+		delete(q.byEmail, next.email)
+		delete(q.byJob, next.job.JobId)
+		q.mu.Unlock()
+	}
+}
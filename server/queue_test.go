@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/pdbogen/autopfs/paizo"
+	"testing"
+	"time"
+)
+
+func TestQueueAdd(t *testing.T) {
+	store, done := testBoltStore(t)
+	defer done()
+
+	// With no workers, jobs stay waiting until they are cancelled.
+	q := NewQueue(store, paizo.Options{}, 0, 2)
+	defer q.Close(time.Second)
+
+	jobs := map[string]*Job{}
+	cases := []struct {
+		Name, Email, Pass string
+		// Same, if set, adds the named job again instead of a new one.
+		Same string
+		// Cancel, if set, cancels the named job before adding.
+		Cancel string
+		// Existing is the name of the job whose ID Add should return, if any.
+		Existing string
+		Err      error
+	}{
+		{Name: "a", Email: "a@example.com", Pass: "hunter2"},
+		{Name: "a again", Email: " A@Example.com", Pass: "hunter2", Existing: "a"},
+		{Name: "a, wrong password", Email: "a@example.com", Pass: "hunter3", Err: ErrAlreadyQueued},
+		{Name: "a, same job", Same: "a", Existing: "a"},
+		{Name: "b", Email: "b@example.com", Pass: "hunter2"},
+		{Name: "c, queue full", Email: "c@example.com", Pass: "hunter2", Err: ErrQueueFull},
+		{Name: "c", Email: "c@example.com", Pass: "hunter2", Cancel: "a"},
+		{Name: "a, after cancel", Email: "a@example.com", Pass: "hunter3", Cancel: "b"},
+	}
+	for _, tc := range cases {
+		if tc.Cancel != "" && !q.Cancel(jobs[tc.Cancel].JobId) {
+			t.Errorf("%s: could not cancel %s", tc.Name, tc.Cancel)
+		}
+
+		job := jobs[tc.Same]
+		if job == nil {
+			var err error
+			if job, err = newJob(tc.Email, tc.Pass); err != nil {
+				t.Fatal(err)
+			}
+		}
+		jobs[tc.Name] = job
+
+		existingId, err := q.Add(job, &Checkpoint{})
+		if err != tc.Err {
+			t.Errorf("%s: got error %v, want %v", tc.Name, err, tc.Err)
+		}
+		wantId := ""
+		if tc.Existing != "" {
+			wantId = jobs[tc.Existing].JobId
+		}
+		if existingId != wantId {
+			t.Errorf("%s: got existing ID %q, want %q", tc.Name, existingId, wantId)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pdbogen/autopfs/types"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Retention decides which finished jobs to delete; the zero Retention keeps them all.
+type Retention struct {
+	// MaxAge, if non-zero, is how long to keep a job after it was last updated.
+	MaxAge time.Duration
+	// MaxJobs, if non-zero, is the most finished jobs to keep; the least recently updated are deleted first.
+	MaxJobs int
+	// PerOwner, if non-zero, is the most finished jobs to keep for each Paizo account; see ownerOf.
+	PerOwner int
+}
+
+// jobsPruned counts the jobs deleted by Prune, for Metrics.
+var jobsPruned int64
+
+// ownerOf returns the keyed hash of a Paizo email address, with which jobs are recorded instead of the address.
+func ownerOf(email string) string {
+	mac := hmac.New(sha256.New, credentialsKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// jobSummary is what Retention and ResumeOrphans need to know about a job.
+type jobSummary struct {
+	// Key is the job's storage key; see jobStorageKey.
+	Key string
+	// Id is the job's ID, if it is unfinished and the ID can be read; see unfinishedId.
+	Id       string
+	Owner    string
+	Updated  time.Time
+	Finished bool
+}
+
+// updated returns the time of the job's last message; or, if it has none, when it was created.
+func updated(job *types.Job) time.Time {
+	if len(job.Messages) > 0 {
+		return job.Messages[len(job.Messages)-1].Time
+	}
+	return job.JobDate
+}
+
+// expired returns the storage keys of the given jobs that the policy says to delete as of now.
+func (r Retention) expired(jobs []jobSummary, now time.Time) []string {
+	jobs = append([]jobSummary(nil), jobs...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Updated.After(jobs[j].Updated)
+	})
+
+	ret := []string{}
+	kept := 0
+	perOwner := map[string]int{}
+	for _, job := range jobs {
+		switch {
+		case !job.Finished:
+			continue
+		case r.MaxAge > 0 && now.Sub(job.Updated) > r.MaxAge,
+			r.PerOwner > 0 && job.Owner != "" && perOwner[job.Owner] >= r.PerOwner,
+			r.MaxJobs > 0 && kept >= r.MaxJobs:
+			ret = append(ret, job.Key)
+			continue
+		}
+		kept++
+		if job.Owner != "" {
+			perOwner[job.Owner]++
+		}
+	}
+	return ret
+}
+
+// Prune deletes the jobs that the policy says to delete, and returns how many were deleted.
+func (r Retention) Prune(store Store) (int, error) {
+	if r == (Retention{}) {
+		return 0, nil
+	}
+
+	jobs, err := store.ListJobs()
+	if err != nil {
+		return 0, fmt.Errorf("listing jobs: %v", err)
+	}
+
+	pruned := 0
+	for _, key := range r.expired(jobs, time.Now()) {
+		deleted, err := store.DeleteJob(key)
+		if err != nil {
+			return pruned, fmt.Errorf("deleting job stored as %q: %v", key, err)
+		}
+		if deleted {
+			pruned++
+		}
+	}
+	atomic.AddInt64(&jobsPruned, int64(pruned))
+	return pruned, nil
+}
+
+// Janitor prunes jobs, and expired logins and sign-in links, every `interval` until ctx is cancelled.
+func (r Retention) Janitor(ctx context.Context, store Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pruned, err := r.Prune(store)
+		if err != nil {
+			log.Errorf("pruning jobs: %v", err)
+		} else if pruned > 0 {
+			log.Infof("Pruned %d expired jobs", pruned)
+		}
+		if err := PruneLogins(store); err != nil {
+			log.Errorf("pruning logins: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeleteJob deletes the job and its checkpoint, returning false if there is no such finished job.
+func DeleteJob(store Store, jobId string) (deleted bool, err error) {
+	deleted, err = store.DeleteJob(string(jobStorageKey(jobId)))
+	if err != nil {
+		return false, fmt.Errorf("deleting job %q: %v", jobId, err)
+	}
+	return deleted, nil
+}
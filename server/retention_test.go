@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	ago := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	// Jobs are listed out of order; expired sorts them by when they were updated.
+	jobs := []jobSummary{
+		{Key: "old", Owner: "x", Updated: ago(40), Finished: true},
+		{Key: "new", Owner: "x", Updated: ago(1), Finished: true},
+		{Key: "running", Owner: "x", Updated: ago(100)},
+		{Key: "mid", Owner: "y", Updated: ago(10), Finished: true},
+		{Key: "imported", Updated: ago(5), Finished: true},
+		{Key: "older", Owner: "x", Updated: ago(20), Finished: true},
+	}
+
+	cases := []struct {
+		Name      string
+		Retention Retention
+		Want      string
+	}{
+		{"zero keeps everything", Retention{}, ""},
+		{"max age", Retention{MaxAge: 15 * 24 * time.Hour}, "older old"},
+		{"max jobs", Retention{MaxJobs: 2}, "mid older old"},
+		{"per owner", Retention{PerOwner: 1}, "older old"},
+		{"per owner ignores imports", Retention{PerOwner: 2}, "old"},
+		{
+			"jobs deleted for one reason do not count against another",
+			Retention{MaxJobs: 3, PerOwner: 1},
+			"older old",
+		},
+		{"combined", Retention{MaxAge: 30 * 24 * time.Hour, MaxJobs: 2, PerOwner: 1}, "mid older old"},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(tc.Retention.expired(jobs, now), " "); got != tc.Want {
+			t.Errorf("%s: got %q, want %q", tc.Name, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"github.com/pdbogen/autopfs/paizo"
+	"github.com/pdbogen/autopfs/types"
+)
+
+// Source is where a job gets its characters and sessions, calling Login first.
+type Source interface {
+	// Name describes the source in job messages, e.g. "Paizo".
+	Name() string
+	// Login signs in with the job's credentials, if the source needs them.
+	Login(ctx context.Context, email, pass string) error
+	// Characters returns the account's characters.
+	Characters(ctx context.Context) ([]types.Character, error)
+	// Sessions returns the account's sessions, one per play, like paizo.GetSessionsWith.
+	Sessions(ctx context.Context, characters []types.Character, opts paizo.SessionOptions) (player,
+		gm []*types.Session, err error)
+}
+
+// paizoSource scrapes paizo.com, or a fixture server standing in for it.
+type paizoSource struct {
+	opts  paizo.Options
+	paizo *paizo.Paizo
+}
+
+func (s *paizoSource) Name() string {
+	return "Paizo"
+}
+
+func (s *paizoSource) Login(ctx context.Context, email, pass string) (err error) {
+	s.paizo, err = paizo.LoginWith(ctx, s.opts, email, pass)
+	return err
+}
+
+func (s *paizoSource) Characters(ctx context.Context) ([]types.Character, error) {
+	return s.paizo.GetCharacters(ctx)
+}
+
+func (s *paizoSource) Sessions(ctx context.Context, characters []types.Character, opts paizo.SessionOptions) ([]*types.Session, []*types.Session, error) {
+	return s.paizo.GetSessionsWith(ctx, characters, opts)
+}
+
+// importSource reads characters and sessions from a job that was saved elsewhere and uploaded, e.g. from another
+// server's /json page.
+type importSource struct {
+	job *types.Job
+}
+
+func (s *importSource) Name() string {
+	return "the imported file"
+}
+
+func (s *importSource) Login(ctx context.Context, email, pass string) error {
+	return nil
+}
+
+func (s *importSource) Characters(ctx context.Context) ([]types.Character, error) {
+	return s.job.Characters, nil
+}
+
+func (s *importSource) Sessions(ctx context.Context, characters []types.Character, opts paizo.SessionOptions) (player, gm []*types.Session, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if opts.Progress != nil {
+		opts.Progress(0, 0)
+	}
+	player, gm = []*types.Session{}, []*types.Session{}
+	plays := s.job.AllPlays()
+	for _, play := range plays {
+		if opts.Known != nil && opts.Known(play) {
+			continue
+		}
+		if play.GM {
+			gm = append(gm, play)
+		} else {
+			player = append(player, play)
+		}
+	}
+	if opts.Page != nil {
+		opts.Page(player, gm)
+	}
+	if opts.Progress != nil {
+		opts.Progress(len(player)+len(gm), len(plays))
+	}
+	return player, gm, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pdbogen/autopfs/types"
+	"time"
+)
+
+// Store persists jobs, their checkpoints, users, and logins, by storage key; see jobStorageKey.
+type Store interface {
+	// LoadJobs returns whichever of the jobs exist, as stored, logging and skipping those that cannot be read.
+	LoadJobs(jobIds []string) ([]*types.Job, error)
+	// SaveJob saves the whole job, replacing any earlier copy.
+	SaveJob(job *types.Job) error
+	// AppendMessage saves the job's newest message and state, or the whole job if it has not been saved yet.
+	AppendMessage(job *types.Job, msg *types.JobMessage) error
+	// ListJobs summarizes every job, without their IDs; see jobSummary.
+	ListJobs() ([]jobSummary, error)
+	// DeleteJob deletes the finished job and its checkpoint, returning false if there is no such finished job.
+	DeleteJob(key string) (bool, error)
+	// QuerySessions returns the job, possibly without its other data, and its sessions as types.Job.Select would.
+	QuerySessions(jobId, mode string, filter types.Filter, order types.Order) (*types.Job, []*types.Session, error)
+
+	// LoadCheckpoint returns the checkpoint of the job with the given ID, or nil if it has none.
+	LoadCheckpoint(jobId string) (*Checkpoint, error)
+	SaveCheckpoint(jobId string, cp *Checkpoint) error
+	DeleteCheckpoint(jobId string) error
+
+	// LoadUser returns the user with the given normalized email address, or nil if there is none.
+	LoadUser(email string) (*User, error)
+	// UpdateUser loads or creates the user, calls update, and saves the user in one transaction unless update fails.
+	UpdateUser(email string, create bool, update func(*User) error) (*User, error)
+
+	// SaveLogin saves a login or link of the given kind, "logins" or "links", by the hash of its token; see login.
+	SaveLogin(kind string, key []byte, l login) error
+	// FindLogin returns the login, expired or not, or nil if there is none, removing it if consume is true.
+	FindLogin(kind string, key []byte, consume bool) (*login, error)
+	// PruneLogins removes the logins and links that expired before now.
+	PruneLogins(now time.Time) error
+
+	// Stats reports the size of the store, for Metrics.
+	Stats() (StoreStats, error)
+	Close() error
+}
+
+// StoreStats describe the size of a Store, for Metrics.
+type StoreStats struct {
+	// Size is the size of the DB file, and Free the unused bytes in it.
+	Size int64
+	Free int64
+	// Records and Inuse are the number and bytes of the records in each bucket or table.
+	Records map[string]int
+	Inuse   map[string]int64
+}
+
+// storeTables are the buckets or tables whose StoreStats Metrics reports.
+var storeTables = []string{"jobs", "checkpoints"}
+
+// OpenStore opens the store of the given kind, "bolt" or "sqlite", at path, migrating it if needed. It should be
+// opened after credentialsKey is loaded, since migrations may need it.
+func OpenStore(kind, path string) (Store, error) {
+	switch kind {
+	case "bolt":
+		return openBoltStore(path)
+	case "sqlite":
+		return openSqliteStore(path)
+	}
+	return nil, fmt.Errorf("unknown store %q; expected bolt or sqlite", kind)
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	bolt "github.com/coreos/bbolt"
+	"github.com/pdbogen/autopfs/types"
+	"os"
+	"time"
+)
+
+// boltStore is a Store in a bolt DB, which keeps jobs and checkpoints in envelopes.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openBoltStore opens and migrates the bolt DB at path, compacting it if any records were migrated.
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, os.FileMode(0640), bolt.DefaultOptions)
+	if err != nil {
+		return nil, fmt.Errorf("could not open bolt DB %q: %v", path, err)
+	}
+
+	migrated, err := Migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating bolt DB %q: %v", path, err)
+	}
+	if migrated > 0 {
+		log.Infof("Compacting %q to discard the old copies of migrated records", path)
+		if err := db.Close(); err != nil {
+			return nil, fmt.Errorf("closing bolt DB %q: %v", path, err)
+		}
+		if err := compactDB(path, os.FileMode(0640)); err != nil {
+			return nil, fmt.Errorf("compacting bolt DB %q: %v", path, err)
+		}
+		if db, err = bolt.Open(path, os.FileMode(0640), bolt.DefaultOptions); err != nil {
+			return nil, fmt.Errorf("could not open bolt DB %q: %v", path, err)
+		}
+	}
+	return &boltStore{db}, nil
+}
+
+func (s *boltStore) LoadJobs(jobIds []string) (jobs []*types.Job, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		jobsBucket := tx.Bucket([]byte("jobs"))
+		if jobsBucket == nil {
+			return nil
+		}
+
+		for _, jobId := range jobIds {
+			stored := jobsBucket.Get(jobStorageKey(jobId))
+			if stored == nil {
+				continue
+			}
+			jobJson, err := openRecord(jobId, stored)
+			if err != nil {
+				log.Warningf("DB contained job with id %q, but could not open: %v", jobId, err)
+				continue
+			}
+
+			job := &types.Job{}
+			if err := json.Unmarshal(jobJson, job); err != nil {
+				log.Warningf("DB contained job with id %q, but could not parse: %v", jobId, err)
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *boltStore) SaveJob(job *types.Job) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		jobs, err := tx.CreateBucketIfNotExists([]byte("jobs"))
+		if err != nil {
+			return fmt.Errorf("error opening jobs bucket: %v", err)
+		}
+
+		jsonBytes, err := json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("error marshaling job to JSON: %v", err)
+		}
+
+		stored, err := sealJob(job, jsonBytes)
+		if err != nil {
+			return fmt.Errorf("error sealing job: %v", err)
+		}
+
+		if err := jobs.Put(jobStorageKey(job.JobId), stored); err != nil {
+			return fmt.Errorf("saving job to DB: %v", err)
+		}
+		return nil
+	})
+}
+
+// AppendMessage saves the whole job, since each job is a single record.
+func (s *boltStore) AppendMessage(job *types.Job, msg *types.JobMessage) error {
+	return s.SaveJob(job)
+}
+
+func (s *boltStore) ListJobs() ([]jobSummary, error) {
+	jobs := []jobSummary{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("jobs"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			env, err := parseEnvelope(v)
+			if err != nil || env == nil {
+				log.Warningf("DB contained job stored as %q, but could not parse: %v", k, err)
+				return nil
+			}
+			id, err := env.jobId()
+			if err != nil {
+				log.Warningf("cannot find the ID of unfinished job stored as %q: %v", k, err)
+			}
+			jobs = append(jobs, jobSummary{
+				Key:      string(k),
+				Id:       id,
+				Owner:    env.Owner,
+				Updated:  env.Updated,
+				Finished: env.Finished,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *boltStore) DeleteJob(key string) (deleted bool, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket([]byte("jobs"))
+		if jobs == nil {
+			return nil
+		}
+		stored := jobs.Get([]byte(key))
+		if stored == nil {
+			return nil
+		}
+		if env, err := parseEnvelope(stored); err == nil && env != nil && !env.Finished {
+			return nil
+		}
+		if err := jobs.Delete([]byte(key)); err != nil {
+			return err
+		}
+		if checkpoints := tx.Bucket([]byte("checkpoints")); checkpoints != nil {
+			if err := checkpoints.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// QuerySessions loads the whole job, since its sessions are sealed with it.
+func (s *boltStore) QuerySessions(jobId, mode string, filter types.Filter, order types.Order) (*types.Job,
+	[]*types.Session, error) {
+	jobs, err := s.LoadJobs([]string{jobId})
+	if err != nil || len(jobs) == 0 {
+		return nil, nil, err
+	}
+	sessions, err := jobs[0].Select(mode, filter, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	return jobs[0], sessions, nil
+}
+
+func (s *boltStore) LoadCheckpoint(jobId string) (cp *Checkpoint, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("checkpoints"))
+		if bucket == nil {
+			return nil
+		}
+		stored := bucket.Get(jobStorageKey(jobId))
+		if stored == nil {
+			return nil
+		}
+		cp, err = openCheckpoint(jobId, stored)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (s *boltStore) SaveCheckpoint(jobId string, cp *Checkpoint) error {
+	stored, err := sealCheckpoint(jobId, cp)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("checkpoints"))
+		if err != nil {
+			return fmt.Errorf("error opening checkpoints bucket: %v", err)
+		}
+		return bucket.Put(jobStorageKey(jobId), stored)
+	})
+}
+
+func (s *boltStore) DeleteCheckpoint(jobId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("checkpoints"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete(jobStorageKey(jobId))
+	})
+}
+
+func (s *boltStore) LoadUser(email string) (user *User, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("users"))
+		if bucket == nil {
+			return nil
+		}
+		userJson := bucket.Get([]byte(email))
+		if userJson == nil {
+			return nil
+		}
+		user = &User{}
+		return unmarshalUser(userJson, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *boltStore) UpdateUser(email string, create bool, update func(*User) error) (*User, error) {
+	user := &User{}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("users"))
+		if err != nil {
+			return fmt.Errorf("error opening users bucket: %v", err)
+		}
+		if userJson := bucket.Get([]byte(email)); userJson != nil {
+			if err := unmarshalUser(userJson, user); err != nil {
+				return fmt.Errorf("parsing user: %v", err)
+			}
+		} else if create {
+			user = &User{Email: email, Created: time.Now()}
+		} else {
+			return fmt.Errorf("no such user %q", email)
+		}
+
+		if err := update(user); err != nil {
+			return err
+		}
+
+		userJson, err := marshalUser(user)
+		if err != nil {
+			return fmt.Errorf("error marshaling user to JSON: %v", err)
+		}
+		return bucket.Put([]byte(email), userJson)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *boltStore) SaveLogin(kind string, key []byte, l login) error {
+	loginJson, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(kind))
+		if err != nil {
+			return fmt.Errorf("error opening %s bucket: %v", kind, err)
+		}
+		return bucket.Put(key, loginJson)
+	})
+}
+
+func (s *boltStore) FindLogin(kind string, key []byte, consume bool) (found *login, err error) {
+	view := s.db.View
+	if consume {
+		view = s.db.Update
+	}
+	err = view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(kind))
+		if bucket == nil {
+			return nil
+		}
+		loginJson := bucket.Get(key)
+		if loginJson == nil {
+			return nil
+		}
+		found = &login{}
+		if err := json.Unmarshal(loginJson, found); err != nil {
+			return err
+		}
+		if consume {
+			return bucket.Delete(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (s *boltStore) PruneLogins(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"logins", "links"} {
+			bucket := tx.Bucket([]byte(name))
+			if bucket == nil {
+				continue
+			}
+			expired := [][]byte{}
+			err := bucket.ForEach(func(k, v []byte) error {
+				l := login{}
+				if err := json.Unmarshal(v, &l); err != nil || now.After(l.Expires) {
+					expired = append(expired, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range expired {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Stats() (StoreStats, error) {
+	stats := StoreStats{
+		Free:    int64(s.db.Stats().FreeAlloc),
+		Records: map[string]int{},
+		Inuse:   map[string]int64{},
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stats.Size = tx.Size()
+		for _, name := range storeTables {
+			if bucket := tx.Bucket([]byte(name)); bucket != nil {
+				bucketStats := bucket.Stats()
+				stats.Records[name] = bucketStats.KeyN
+				stats.Inuse[name] = int64(bucketStats.BranchInuse + bucketStats.LeafInuse)
+			}
+		}
+		return nil
+	})
+	return stats, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,768 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pdbogen/autopfs/types"
+	"strings"
+	"time"
+)
+
+// sqliteStore is a Store in a SQLite DB, which keeps jobs' sessions, plays, characters, and messages unencrypted in
+// tables, so that they can be queried across jobs.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// sqliteMigrations are applied in order, up from the DB's user_version; only ever append to them.
+var sqliteMigrations = []string{
+	`CREATE TABLE jobs (
+		storage_key    TEXT PRIMARY KEY,
+		sealed_id      BLOB,
+		state          TEXT NOT NULL,
+		owner          TEXT NOT NULL,
+		job_date       INTEGER,
+		updated        INTEGER,
+		finished       INTEGER NOT NULL,
+		schema_version INTEGER NOT NULL,
+		-- whether Sessions and Plays are non-nil; see types.Job AllPlays.
+		has_sessions   INTEGER NOT NULL,
+		has_plays      INTEGER NOT NULL
+	);
+	CREATE INDEX jobs_owner ON jobs (owner);
+
+	CREATE TABLE messages (
+		storage_key TEXT NOT NULL REFERENCES jobs ON DELETE CASCADE,
+		seq         INTEGER NOT NULL,
+		time        INTEGER,
+		state       TEXT NOT NULL,
+		message     TEXT NOT NULL,
+		PRIMARY KEY (storage_key, seq)
+	);
+
+	CREATE TABLE characters (
+		storage_key TEXT NOT NULL REFERENCES jobs ON DELETE CASCADE,
+		pos         INTEGER NOT NULL,
+		system      INTEGER NOT NULL,
+		number      INTEGER NOT NULL,
+		name        TEXT NOT NULL,
+		faction     TEXT NOT NULL,
+		PRIMARY KEY (storage_key, pos)
+	);
+	CREATE TABLE character_prestige (
+		storage_key TEXT NOT NULL,
+		pos         INTEGER NOT NULL,
+		faction     TEXT NOT NULL,
+		prestige    INTEGER NOT NULL,
+		PRIMARY KEY (storage_key, pos, faction),
+		FOREIGN KEY (storage_key, pos) REFERENCES characters ON DELETE CASCADE
+	);
+
+	-- sessions holds both a job's Sessions, with merged = 1, and its Plays, with merged = 0.
+	CREATE TABLE sessions (
+		storage_key   TEXT NOT NULL REFERENCES jobs ON DELETE CASCADE,
+		merged        INTEGER NOT NULL,
+		pos           INTEGER NOT NULL,
+		date          INTEGER,
+		game          TEXT NOT NULL,
+		season        INTEGER NOT NULL,
+		number        INTEGER NOT NULL,
+		variant       TEXT NOT NULL,
+		scenario_name TEXT NOT NULL,
+		type          TEXT NOT NULL,
+		player        INTEGER NOT NULL,
+		gm            INTEGER NOT NULL,
+		prestige      INTEGER NOT NULL,
+		points        INTEGER NOT NULL,
+		faction       TEXT NOT NULL,
+		PRIMARY KEY (storage_key, merged, pos)
+	);
+	CREATE INDEX sessions_scenario ON sessions (game, season, number);
+	CREATE TABLE session_events (
+		storage_key TEXT NOT NULL,
+		merged      INTEGER NOT NULL,
+		pos         INTEGER NOT NULL,
+		seq         INTEGER NOT NULL,
+		event       INTEGER NOT NULL,
+		PRIMARY KEY (storage_key, merged, pos, seq),
+		FOREIGN KEY (storage_key, merged, pos) REFERENCES sessions ON DELETE CASCADE
+	);
+	CREATE INDEX session_events_event ON session_events (event);
+	CREATE TABLE session_characters (
+		storage_key TEXT NOT NULL,
+		merged      INTEGER NOT NULL,
+		pos         INTEGER NOT NULL,
+		seq         INTEGER NOT NULL,
+		character   INTEGER NOT NULL,
+		PRIMARY KEY (storage_key, merged, pos, seq),
+		FOREIGN KEY (storage_key, merged, pos) REFERENCES sessions ON DELETE CASCADE
+	);
+	CREATE INDEX session_characters_character ON session_characters (character);
+
+	-- Checkpoints are sealed, and have no job until the job is first saved; see sealCheckpoint.
+	CREATE TABLE checkpoints (
+		storage_key TEXT PRIMARY KEY,
+		data        BLOB NOT NULL
+	);
+
+	-- See marshalUser.
+	CREATE TABLE users (
+		email TEXT PRIMARY KEY,
+		data  BLOB NOT NULL
+	);
+
+	CREATE TABLE logins (
+		kind       TEXT NOT NULL,
+		token_hash BLOB NOT NULL,
+		data       BLOB NOT NULL,
+		expires    INTEGER NOT NULL,
+		PRIMARY KEY (kind, token_hash)
+	);`,
+}
+
+// sqlQueryer is a *sql.DB or *sql.Tx.
+type sqlQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// openSqliteStore opens the SQLite DB at path, creating it if it does not exist, and migrates it.
+func openSqliteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=1&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("could not open SQLite DB %q: %v", path, err)
+	}
+	// SQLite allows one writer at a time; one connection keeps transactions from failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteStore{db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating SQLite DB %q: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *sqliteStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("the DB has schema version %d, but this server only knows up to %d", version,
+			len(sqliteMigrations))
+	}
+
+	for i, migration := range sqliteMigrations[version:] {
+		version := version + i + 1
+		err := s.transact(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migrating the DB to schema version %d: %v", version, err)
+		}
+		log.Infof("Migrated the SQLite DB to schema version %d", version)
+	}
+	return nil
+}
+
+// transact calls f in a transaction, which is committed if f returns nil, and rolled back otherwise.
+func (s *sqliteStore) transact(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlTime returns how to store t.
+func sqlTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// goTime reverses sqlTime.
+func goTime(n sql.NullInt64) time.Time {
+	if !n.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, n.Int64)
+}
+
+func (s *sqliteStore) LoadJobs(jobIds []string) (jobs []*types.Job, err error) {
+	err = s.transact(func(tx *sql.Tx) error {
+		for _, jobId := range jobIds {
+			job, hasPlays, err := loadJobRow(tx, jobId)
+			if err != nil {
+				return err
+			}
+			if job == nil {
+				continue
+			}
+			if err := loadJobData(tx, job, hasPlays); err != nil {
+				log.Warningf("DB contained job with id %q, but could not read: %v", jobId, err)
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// loadJobRow returns the job without its other data, and whether it has plays; or nil if there is no such job.
+func loadJobRow(q sqlQueryer, jobId string) (*types.Job, bool, error) {
+	job := &types.Job{JobId: jobId}
+	var jobDate sql.NullInt64
+	var hasSessions, hasPlays bool
+	err := q.QueryRow(`SELECT state, owner, job_date, schema_version, has_sessions, has_plays FROM jobs
+		WHERE storage_key = ?`, string(jobStorageKey(jobId))).
+		Scan(&job.State, &job.Owner, &jobDate, &job.Schema, &hasSessions, &hasPlays)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("loading job %q: %v", jobId, err)
+	}
+	job.JobDate = goTime(jobDate)
+	if hasSessions {
+		job.Sessions = []*types.Session{}
+	}
+	return job, hasPlays, nil
+}
+
+// loadJobData loads the sessions, plays, characters, and messages of the job returned by loadJobRow.
+func loadJobData(q sqlQueryer, job *types.Job, hasPlays bool) error {
+	key := string(jobStorageKey(job.JobId))
+	var err error
+	if job.Sessions != nil {
+		if job.Sessions, err = loadSessions(q, key, true, "", nil); err != nil {
+			return err
+		}
+	}
+	if hasPlays {
+		if job.Plays, err = loadSessions(q, key, false, "", nil); err != nil {
+			return err
+		}
+	}
+	if job.Characters, err = loadCharacters(q, key); err != nil {
+		return err
+	}
+
+	rows, err := q.Query(`SELECT time, state, message FROM messages WHERE storage_key = ? ORDER BY seq`, key)
+	if err != nil {
+		return fmt.Errorf("loading messages: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		msg := &types.JobMessage{JobId: job.JobId}
+		var msgTime sql.NullInt64
+		if err := rows.Scan(&msgTime, &msg.State, &msg.Message); err != nil {
+			return fmt.Errorf("loading messages: %v", err)
+		}
+		msg.Time = goTime(msgTime)
+		job.Messages = append(job.Messages, msg)
+	}
+	return rows.Err()
+}
+
+func loadCharacters(q sqlQueryer, key string) ([]types.Character, error) {
+	rows, err := q.Query(`SELECT system, number, name, faction FROM characters WHERE storage_key = ? ORDER BY pos`,
+		key)
+	if err != nil {
+		return nil, fmt.Errorf("loading characters: %v", err)
+	}
+	chars := []types.Character{}
+	for rows.Next() {
+		char := types.Character{}
+		if err := rows.Scan(&char.System, &char.Number, &char.Name, &char.Faction); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("loading characters: %v", err)
+		}
+		chars = append(chars, char)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading characters: %v", err)
+	}
+
+	rows, err = q.Query(`SELECT pos, faction, prestige FROM character_prestige WHERE storage_key = ?`, key)
+	if err != nil {
+		return nil, fmt.Errorf("loading prestige: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pos, prestige int
+		var faction string
+		if err := rows.Scan(&pos, &faction, &prestige); err != nil {
+			return nil, fmt.Errorf("loading prestige: %v", err)
+		}
+		if pos < 0 || pos >= len(chars) {
+			continue
+		}
+		if chars[pos].Prestige == nil {
+			chars[pos].Prestige = map[string]int{}
+		}
+		chars[pos].Prestige[faction] = prestige
+	}
+	return chars, rows.Err()
+}
+
+// loadSessions loads the job's merged sessions or plays, in order, that match the SQL condition `where`, if any.
+func loadSessions(q sqlQueryer, key string, merged bool, where string, args []interface{}) ([]*types.Session,
+	error) {
+	query := `SELECT pos, date, game, season, number, variant, scenario_name, type, player, gm, prestige, points,
+		faction FROM sessions WHERE storage_key = ? AND merged = ?`
+	if where != "" {
+		query += " AND " + where
+	}
+	rows, err := q.Query(query+" ORDER BY pos", append([]interface{}{key, merged}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("loading sessions: %v", err)
+	}
+	sessions := []*types.Session{}
+	byPos := map[int]*types.Session{}
+	for rows.Next() {
+		sess := &types.Session{}
+		var pos int
+		var date sql.NullInt64
+		err := rows.Scan(&pos, &date, &sess.Game, &sess.Season, &sess.Number, &sess.Variant, &sess.ScenarioName,
+			&sess.Type, &sess.Player, &sess.GM, &sess.Prestige, &sess.Points, &sess.Faction)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("loading sessions: %v", err)
+		}
+		if date.Valid {
+			sess.Date = goTime(date).UTC()
+		}
+		sessions = append(sessions, sess)
+		byPos[pos] = sess
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading sessions: %v", err)
+	}
+
+	for _, table := range []string{"session_events", "session_characters"} {
+		column := "event"
+		if table == "session_characters" {
+			column = "character"
+		}
+		rows, err := q.Query(`SELECT pos, `+column+` FROM `+table+` WHERE storage_key = ? AND merged = ?
+			ORDER BY pos, seq`, key, merged)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %v", table, err)
+		}
+		for rows.Next() {
+			var pos int
+			var value int64
+			if err := rows.Scan(&pos, &value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("loading %s: %v", table, err)
+			}
+			sess := byPos[pos]
+			if sess == nil {
+				continue
+			}
+			if table == "session_events" {
+				sess.EventNumber = append(sess.EventNumber, value)
+			} else {
+				sess.Character = append(sess.Character, int(value))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("loading %s: %v", table, err)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *sqliteStore) SaveJob(job *types.Job) error {
+	return s.transact(func(tx *sql.Tx) error {
+		return saveJob(tx, job)
+	})
+}
+
+// saveJob replaces the whole job.
+func saveJob(tx *sql.Tx, job *types.Job) error {
+	key := string(jobStorageKey(job.JobId))
+	if _, err := tx.Exec(`DELETE FROM jobs WHERE storage_key = ?`, key); err != nil {
+		return fmt.Errorf("deleting old copy of job: %v", err)
+	}
+
+	sealedId, err := unfinishedId(job)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO jobs (storage_key, sealed_id, state, owner, job_date, updated, finished,
+		schema_version, has_sessions, has_plays) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key, sealedId, job.State, job.Owner, sqlTime(job.JobDate), sqlTime(updated(job)), job.Finished(),
+		job.Schema, job.Sessions != nil, job.Plays != nil)
+	if err != nil {
+		return fmt.Errorf("saving job: %v", err)
+	}
+
+	for seq, msg := range job.Messages {
+		_, err := tx.Exec(`INSERT INTO messages (storage_key, seq, time, state, message) VALUES (?, ?, ?, ?, ?)`,
+			key, seq, sqlTime(msg.Time), msg.State, msg.Message)
+		if err != nil {
+			return fmt.Errorf("saving messages: %v", err)
+		}
+	}
+
+	for pos, char := range job.Characters {
+		_, err := tx.Exec(`INSERT INTO characters (storage_key, pos, system, number, name, faction)
+			VALUES (?, ?, ?, ?, ?, ?)`, key, pos, char.System, char.Number, char.Name, char.Faction)
+		if err != nil {
+			return fmt.Errorf("saving characters: %v", err)
+		}
+		for faction, prestige := range char.Prestige {
+			_, err := tx.Exec(`INSERT INTO character_prestige (storage_key, pos, faction, prestige)
+				VALUES (?, ?, ?, ?)`, key, pos, faction, prestige)
+			if err != nil {
+				return fmt.Errorf("saving prestige: %v", err)
+			}
+		}
+	}
+
+	if err := saveSessions(tx, key, true, job.Sessions); err != nil {
+		return err
+	}
+	return saveSessions(tx, key, false, job.Plays)
+}
+
+func saveSessions(tx *sql.Tx, key string, merged bool, sessions []*types.Session) error {
+	for pos, sess := range sessions {
+		_, err := tx.Exec(`INSERT INTO sessions (storage_key, merged, pos, date, game, season, number, variant,
+			scenario_name, type, player, gm, prestige, points, faction)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			key, merged, pos, sqlTime(sess.Date), sess.Game, sess.Season, sess.Number, sess.Variant,
+			sess.ScenarioName, sess.Type, sess.Player, sess.GM, sess.Prestige, sess.Points, sess.Faction)
+		if err != nil {
+			return fmt.Errorf("saving sessions: %v", err)
+		}
+		for seq, event := range sess.EventNumber {
+			_, err := tx.Exec(`INSERT INTO session_events (storage_key, merged, pos, seq, event)
+				VALUES (?, ?, ?, ?, ?)`, key, merged, pos, seq, event)
+			if err != nil {
+				return fmt.Errorf("saving session events: %v", err)
+			}
+		}
+		for seq, char := range sess.Character {
+			_, err := tx.Exec(`INSERT INTO session_characters (storage_key, merged, pos, seq, character)
+				VALUES (?, ?, ?, ?, ?)`, key, merged, pos, seq, char)
+			if err != nil {
+				return fmt.Errorf("saving session characters: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) AppendMessage(job *types.Job, msg *types.JobMessage) error {
+	key := string(jobStorageKey(job.JobId))
+	sealedId, err := unfinishedId(job)
+	if err != nil {
+		return err
+	}
+	return s.transact(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE jobs SET sealed_id = ?, state = ?, owner = ?, updated = ?, finished = ?
+			WHERE storage_key = ?`, sealedId, job.State, job.Owner, sqlTime(updated(job)), job.Finished(), key)
+		if err != nil {
+			return fmt.Errorf("saving job: %v", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return saveJob(tx, job)
+		}
+
+		_, err = tx.Exec(`INSERT INTO messages (storage_key, seq, time, state, message)
+			SELECT ?, coalesce(max(seq) + 1, 0), ?, ?, ? FROM messages WHERE storage_key = ?`,
+			key, sqlTime(msg.Time), msg.State, msg.Message, key)
+		if err != nil {
+			return fmt.Errorf("saving message: %v", err)
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) ListJobs() ([]jobSummary, error) {
+	rows, err := s.db.Query(`SELECT storage_key, sealed_id, owner, updated, finished FROM jobs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []jobSummary{}
+	for rows.Next() {
+		job := jobSummary{}
+		var sealedId []byte
+		var updated sql.NullInt64
+		if err := rows.Scan(&job.Key, &sealedId, &job.Owner, &updated, &job.Finished); err != nil {
+			return nil, err
+		}
+		job.Updated = goTime(updated)
+		if job.Id, err = openJobId(sealedId); err != nil {
+			log.Warningf("cannot find the ID of unfinished job stored as %q: %v", job.Key, err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *sqliteStore) DeleteJob(key string) (deleted bool, err error) {
+	err = s.transact(func(tx *sql.Tx) error {
+		var finished bool
+		err := tx.QueryRow(`SELECT finished FROM jobs WHERE storage_key = ?`, key).Scan(&finished)
+		if err == sql.ErrNoRows || (err == nil && !finished) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM jobs WHERE storage_key = ?`, key); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM checkpoints WHERE storage_key = ?`, key); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// QuerySessions loads only the sessions that may match, and leaves the rest to types.Job.Select.
+func (s *sqliteStore) QuerySessions(jobId, mode string, filter types.Filter, order types.Order) (job *types.Job,
+	sessions []*types.Session, err error) {
+	err = s.transact(func(tx *sql.Tx) error {
+		loaded, hasPlays, err := loadJobRow(tx, jobId)
+		if err != nil || loaded == nil {
+			return err
+		}
+		job = loaded
+
+		where, args := sessionConditions(filter)
+		merged := mode == "" || mode == types.ModeMerged || !hasPlays
+		candidates, err := loadSessions(tx, string(jobStorageKey(jobId)), merged, where, args)
+		if err != nil {
+			return err
+		}
+		if merged {
+			job.Sessions = candidates
+		} else {
+			job.Plays = candidates
+		}
+		if sessions, err = job.Select(mode, filter, order); err != nil {
+			return err
+		}
+		job.Sessions, job.Plays = nil, nil
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, sessions, nil
+}
+
+// sessionConditions returns an SQL condition, and its arguments, that holds for every session the filter selects.
+func sessionConditions(filter types.Filter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.Game != "" {
+		conditions = append(conditions, "game = ? COLLATE NOCASE")
+		args = append(args, filter.Game)
+	}
+	if filter.Season != nil {
+		conditions = append(conditions, "season = ?")
+		args = append(args, *filter.Season)
+	}
+	if filter.Character != 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM session_characters AS c
+			WHERE c.storage_key = sessions.storage_key AND c.merged = sessions.merged AND c.pos = sessions.pos
+			AND c.character IN (?, ?))`)
+		args = append(args, filter.Character, -filter.Character)
+	}
+	switch filter.Role {
+	case types.RolePlayer:
+		conditions = append(conditions, "player")
+	case types.RoleGM:
+		conditions = append(conditions, "gm")
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		conditions = append(conditions, "date IS NOT NULL")
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "date >= ?")
+		args = append(args, filter.From.UnixNano())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "date < ?")
+		args = append(args, filter.To.UnixNano())
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (s *sqliteStore) LoadCheckpoint(jobId string) (*Checkpoint, error) {
+	var stored []byte
+	err := s.db.QueryRow(`SELECT data FROM checkpoints WHERE storage_key = ?`, string(jobStorageKey(jobId))).
+		Scan(&stored)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return openCheckpoint(jobId, stored)
+}
+
+func (s *sqliteStore) SaveCheckpoint(jobId string, cp *Checkpoint) error {
+	stored, err := sealCheckpoint(jobId, cp)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO checkpoints (storage_key, data) VALUES (?, ?)`,
+		string(jobStorageKey(jobId)), stored)
+	return err
+}
+
+func (s *sqliteStore) DeleteCheckpoint(jobId string) error {
+	_, err := s.db.Exec(`DELETE FROM checkpoints WHERE storage_key = ?`, string(jobStorageKey(jobId)))
+	return err
+}
+
+func (s *sqliteStore) LoadUser(email string) (*User, error) {
+	return loadUser(s.db, email)
+}
+
+// loadUser returns the user with the given normalized email address, or nil if there is none.
+func loadUser(q sqlQueryer, email string) (*User, error) {
+	var userJson []byte
+	err := q.QueryRow(`SELECT data FROM users WHERE email = ?`, email).Scan(&userJson)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := &User{}
+	if err := unmarshalUser(userJson, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *sqliteStore) UpdateUser(email string, create bool, update func(*User) error) (user *User, err error) {
+	err = s.transact(func(tx *sql.Tx) error {
+		loaded, err := loadUser(tx, email)
+		if err != nil {
+			return fmt.Errorf("parsing user: %v", err)
+		}
+		if loaded == nil && !create {
+			return fmt.Errorf("no such user %q", email)
+		} else if loaded == nil {
+			loaded = &User{Email: email, Created: time.Now()}
+		}
+		user = loaded
+
+		if err := update(user); err != nil {
+			return err
+		}
+
+		userJson, err := marshalUser(user)
+		if err != nil {
+			return fmt.Errorf("error marshaling user to JSON: %v", err)
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO users (email, data) VALUES (?, ?)`, email, userJson)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *sqliteStore) SaveLogin(kind string, key []byte, l login) error {
+	loginJson, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO logins (kind, token_hash, data, expires) VALUES (?, ?, ?, ?)`,
+		kind, key, loginJson, l.Expires.UnixNano())
+	return err
+}
+
+func (s *sqliteStore) FindLogin(kind string, key []byte, consume bool) (found *login, err error) {
+	err = s.transact(func(tx *sql.Tx) error {
+		var loginJson []byte
+		err := tx.QueryRow(`SELECT data FROM logins WHERE kind = ? AND token_hash = ?`, kind, key).Scan(&loginJson)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = &login{}
+		if err := json.Unmarshal(loginJson, found); err != nil {
+			return err
+		}
+		if consume {
+			_, err = tx.Exec(`DELETE FROM logins WHERE kind = ? AND token_hash = ?`, kind, key)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (s *sqliteStore) PruneLogins(now time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM logins WHERE expires < ?`, now.UnixNano())
+	return err
+}
+
+// Stats does not report Inuse, which SQLite can tell only if it was built with the dbstat table.
+func (s *sqliteStore) Stats() (StoreStats, error) {
+	stats := StoreStats{Records: map[string]int{}}
+	var pageSize, pages, free int64
+	for pragma, dest := range map[string]*int64{"page_size": &pageSize, "page_count": &pages, "freelist_count": &free} {
+		if err := s.db.QueryRow("PRAGMA " + pragma).Scan(dest); err != nil {
+			return stats, err
+		}
+	}
+	stats.Size, stats.Free = pages*pageSize, free*pageSize
+	for _, table := range storeTables {
+		var n int
+		if err := s.db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+			return stats, err
+		}
+		stats.Records[table] = n
+	}
+	return stats, nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/pdbogen/autopfs/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStore returns a new store of the given kind in a temporary directory, and a function that closes and removes it.
+func testStore(t *testing.T, kind string) (Store, func()) {
+	dir, err := ioutil.TempDir("", "autopfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(kind, filepath.Join(dir, "test.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// testBoltStore returns a new bolt store in a temporary directory, and a function that closes and removes it.
+func testBoltStore(t *testing.T) (Store, func()) {
+	return testStore(t, "bolt")
+}
+
+// storeTests are run against each kind of Store by TestStores, so that every store behaves the same.
+var storeTests = []struct {
+	Name string
+	Test func(t *testing.T, store Store)
+}{
+	{"jobs", testStoreJobs},
+	{"sessions", testStoreSessions},
+	{"checkpoints", testStoreCheckpoints},
+	{"users", testStoreUsers},
+	{"logins", testStoreLogins},
+}
+
+func TestStores(t *testing.T) {
+	defer withCredentialsKey(bytes.Repeat([]byte{7}, 32))()
+	for _, kind := range []string{"bolt", "sqlite"} {
+		for _, test := range storeTests {
+			t.Run(kind+"/"+test.Name, func(t *testing.T) {
+				store, done := testStore(t, kind)
+				defer done()
+				test.Test(t, store)
+			})
+		}
+	}
+}
+
+// storedJson returns the job as JSON, with its times in UTC, for comparison with a job as it was saved.
+func storedJson(job *types.Job) string {
+	copied := *job
+	copied.JobDate = copied.JobDate.UTC()
+	copied.Messages = nil
+	for _, msg := range job.Messages {
+		utc := *msg
+		utc.Time = utc.Time.UTC()
+		copied.Messages = append(copied.Messages, &utc)
+	}
+	return jsonString(copied)
+}
+
+var storeTestDate = time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+
+// storeTestJob returns a job with some of everything that a store saves.
+func storeTestJob(id, state string) *types.Job {
+	plays := []*types.Session{
+		{Date: time.Date(2019, 8, 3, 0, 0, 0, 0, time.UTC), EventNumber: []int64{54321}, Game: "Pathfinder2",
+			Season: 1, Number: 1, ScenarioName: "The Absalom Initiation", Type: types.TypeScenario,
+			Character: []int{2001}, Player: true, Prestige: 4, Points: 1, Faction: "Envoy's Alliance"},
+		{Date: time.Date(2018, 5, 5, 0, 0, 0, 0, time.UTC), EventNumber: []int64{12345}, Game: "Pathfinder",
+			Season: 5, Number: 8, Variant: "A", ScenarioName: "The Confirmation", Type: types.TypeScenario,
+			Character: []int{2}, Player: true, Prestige: 2, Faction: "Grand Lodge"},
+		{Date: time.Date(2018, 6, 2, 0, 0, 0, 0, time.UTC), EventNumber: []int64{23456}, Game: "Pathfinder",
+			Season: 5, Number: 8, ScenarioName: "The Confirmation", Type: types.TypeScenario,
+			Character: []int{-1}, GM: true, Prestige: 2},
+	}
+	return &types.Job{
+		JobId:    id,
+		State:    state,
+		Sessions: types.DeDupe(plays),
+		Plays:    plays,
+		Messages: []*types.JobMessage{
+			{Time: storeTestDate, Message: "Logging in...", State: "login"},
+			{Time: storeTestDate.Add(time.Minute), Message: "Done!", State: state},
+		},
+		JobDate: storeTestDate,
+		Characters: []types.Character{
+			{System: types.Pathfinder, Number: 2, Name: "Seoni", Prestige: map[string]int{"Grand Lodge": 4},
+				Faction: "Grand Lodge"},
+			{System: types.Pathfinder2, Number: 2001, Name: "Ezren"},
+		},
+		Owner:  "owner-" + id,
+		Schema: jobSchema,
+	}
+}
+
+func testStoreJobs(t *testing.T, store Store) {
+	finished := storeTestJob("finished-job", types.JobStateDone)
+	running := storeTestJob("running-job", "scraping")
+	running.Messages = running.Messages[:1]
+	for _, job := range []*types.Job{finished, running} {
+		if err := store.SaveJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := store.LoadJobs([]string{"running-job", "missing-job", "finished-job"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("loaded %d jobs, want 2", len(jobs))
+	}
+	for i, want := range []*types.Job{running, finished} {
+		if got, want := storedJson(jobs[i]), storedJson(want); got != want {
+			t.Errorf("loaded job %d:\n got: %s\nwant: %s", i, got, want)
+		}
+	}
+
+	msg := &types.JobMessage{Time: storeTestDate.Add(time.Hour), Message: "Done!", State: types.JobStateDone}
+	running.Messages = append(running.Messages, msg)
+	running.State = types.JobStateDone
+	if err := store.AppendMessage(running, msg); err != nil {
+		t.Fatal(err)
+	}
+	// A job that has not been saved is saved whole.
+	unsaved := storeTestJob("unsaved-job", "init")
+	if err := store.AppendMessage(unsaved, unsaved.Messages[len(unsaved.Messages)-1]); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err = store.LoadJobs([]string{"running-job", "unsaved-job"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("loaded %d jobs, want 2", len(jobs))
+	}
+	for i, want := range []*types.Job{running, unsaved} {
+		if got, want := storedJson(jobs[i]), storedJson(want); got != want {
+			t.Errorf("job %d after appending:\n got: %s\nwant: %s", i, got, want)
+		}
+	}
+
+	summaries, err := store.ListJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKey := map[string]jobSummary{}
+	for _, summary := range summaries {
+		byKey[summary.Key] = summary
+	}
+	if len(byKey) != 3 {
+		t.Errorf("listed %d jobs, want 3", len(byKey))
+	}
+	for _, job := range []*types.Job{finished, running, unsaved} {
+		summary, ok := byKey[string(jobStorageKey(job.JobId))]
+		if !ok {
+			t.Errorf("job %q was not listed", job.JobId)
+			continue
+		}
+		wantId := ""
+		if !job.Finished() {
+			wantId = job.JobId
+		}
+		if summary.Id != wantId || summary.Owner != job.Owner || summary.Finished != job.Finished() ||
+			!summary.Updated.Equal(updated(job)) {
+			t.Errorf("job %q was listed as %+v", job.JobId, summary)
+		}
+	}
+
+	for _, tc := range []struct {
+		Id      string
+		Deleted bool
+	}{
+		{"unsaved-job", false},
+		{"finished-job", true},
+		{"finished-job", false},
+		{"missing-job", false},
+	} {
+		if deleted, err := store.DeleteJob(string(jobStorageKey(tc.Id))); err != nil || deleted != tc.Deleted {
+			t.Errorf("deleting %q: got %v, %v; want %v", tc.Id, deleted, err, tc.Deleted)
+		}
+	}
+	if jobs, err := store.LoadJobs([]string{"finished-job"}); err != nil || len(jobs) != 0 {
+		t.Errorf("loaded %d deleted jobs, %v", len(jobs), err)
+	}
+}
+
+func testStoreSessions(t *testing.T, store Store) {
+	job := storeTestJob("a-job", types.JobStateDone)
+	if err := store.SaveJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Mode   string
+		Filter types.Filter
+		Order  types.Order
+		Want   []string
+	}{
+		{Mode: types.ModeMerged, Want: []string{"The Confirmation", "The Absalom Initiation"}},
+		{Mode: types.ModePlays, Filter: types.Filter{Game: "Pathfinder"},
+			Want: []string{"The Confirmation", "The Confirmation"}},
+		{Mode: types.ModePlays, Filter: types.Filter{Role: types.RoleGM}, Want: []string{"The Confirmation"}},
+		{Mode: types.ModeGrouped, Order: types.Order{Key: types.SortDate},
+			Want: []string{"The Confirmation", "The Confirmation", "The Absalom Initiation"}},
+	}
+	for _, tc := range cases {
+		got, sessions, err := store.QuerySessions(job.JobId, tc.Mode, tc.Filter, tc.Order)
+		if err != nil {
+			t.Errorf("%s %+v: %v", tc.Mode, tc.Filter, err)
+			continue
+		}
+		if got == nil || got.JobId != job.JobId || got.State != job.State {
+			t.Errorf("%s %+v: got job %+v", tc.Mode, tc.Filter, got)
+		}
+		want, err := job.Select(tc.Mode, tc.Filter, tc.Order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if jsonString(sessions) != jsonString(want) {
+			t.Errorf("%s %+v:\n got: %s\nwant: %s", tc.Mode, tc.Filter, jsonString(sessions), jsonString(want))
+		}
+		names := []string{}
+		for _, sess := range sessions {
+			names = append(names, sess.ScenarioName)
+		}
+		if jsonString(names) != jsonString(tc.Want) {
+			t.Errorf("%s %+v: got %q, want %q", tc.Mode, tc.Filter, names, tc.Want)
+		}
+	}
+
+	if got, sessions, err := store.QuerySessions("missing-job", "", types.Filter{}, types.Order{}); got != nil ||
+		sessions != nil || err != nil {
+		t.Errorf("missing job: got %+v, %v, %v", got, sessions, err)
+	}
+}
+
+func testStoreCheckpoints(t *testing.T, store Store) {
+	if cp, err := store.LoadCheckpoint("a-job"); cp != nil || err != nil {
+		t.Errorf("got checkpoint %+v, %v before saving one", cp, err)
+	}
+
+	cp := &Checkpoint{
+		Refresh:     true,
+		Credentials: []byte("sealed"),
+		PageUrl:     "https://example.com/next",
+		Player:      storeTestJob("a-job", "").Plays[:2],
+		GM:          storeTestJob("a-job", "").Plays[2:],
+	}
+	if err := store.SaveCheckpoint("a-job", cp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.LoadCheckpoint("a-job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonString(got) != jsonString(cp) {
+		t.Errorf("loaded checkpoint:\n got: %s\nwant: %s", jsonString(got), jsonString(cp))
+	}
+	if got, err := store.LoadCheckpoint("another-job"); got != nil || err != nil {
+		t.Errorf("got another job's checkpoint %+v, %v", got, err)
+	}
+
+	if err := store.DeleteCheckpoint("a-job"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.LoadCheckpoint("a-job"); got != nil || err != nil {
+		t.Errorf("got checkpoint %+v, %v after deleting it", got, err)
+	}
+}
+
+func testStoreUsers(t *testing.T, store Store) {
+	if user, err := store.LoadUser("a@example.com"); user != nil || err != nil {
+		t.Errorf("got user %+v, %v before creating one", user, err)
+	}
+	noop := func(*User) error { return nil }
+	if _, err := store.UpdateUser("a@example.com", false, noop); err == nil {
+		t.Error("updated a user that does not exist")
+	}
+
+	_, err := store.UpdateUser("a@example.com", true, func(user *User) error {
+		user.PasswordHash = []byte("hash")
+		user.Jobs = append(user.Jobs, "first-job")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.UpdateUser("a@example.com", false, func(user *User) error {
+		user.Jobs = append(user.Jobs, "second-job")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	_, err = store.UpdateUser("a@example.com", false, func(user *User) error {
+		user.Jobs = nil
+		return failed
+	})
+	if err != failed {
+		t.Errorf("got %v from a failed update, want %v", err, failed)
+	}
+
+	user, err := store.LoadUser("a@example.com")
+	if err != nil || user == nil {
+		t.Fatalf("got user %+v, %v", user, err)
+	}
+	if user.Email != "a@example.com" || string(user.PasswordHash) != "hash" || user.Created.IsZero() ||
+		jsonString(user.Jobs) != `["first-job","second-job"]` || user.SealedJobs != nil {
+		t.Errorf("got user %+v", user)
+	}
+}
+
+func testStoreLogins(t *testing.T, store Store) {
+	now := time.Now()
+	logins := []struct {
+		Kind string
+		Key  string
+		login
+	}{
+		{"logins", "current", login{Email: "a@example.com", Expires: now.Add(time.Hour)}},
+		{"logins", "expired", login{Email: "a@example.com", Expires: now.Add(-time.Hour)}},
+		{"links", "current", login{Email: "b@example.com", Expires: now.Add(time.Hour), PasswordHash: []byte("hash")}},
+	}
+	for _, l := range logins {
+		if err := store.SaveLogin(l.Kind, []byte(l.Key), l.login); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, l := range logins {
+		got, err := store.FindLogin(l.Kind, []byte(l.Key), false)
+		if err != nil || got == nil {
+			t.Errorf("%s %q: got %+v, %v", l.Kind, l.Key, got, err)
+			continue
+		}
+		if got.Email != l.Email || !got.Expires.Equal(l.Expires) || string(got.PasswordHash) != string(l.PasswordHash) {
+			t.Errorf("%s %q: got %+v, want %+v", l.Kind, l.Key, got, l.login)
+		}
+	}
+	if got, err := store.FindLogin("links", []byte("expired"), false); got != nil || err != nil {
+		t.Errorf("found a login as a link: %+v, %v", got, err)
+	}
+
+	if got, err := store.FindLogin("links", []byte("current"), true); got == nil || err != nil {
+		t.Errorf("consuming link: got %+v, %v", got, err)
+	}
+	if got, err := store.FindLogin("links", []byte("current"), true); got != nil || err != nil {
+		t.Errorf("consumed the same link twice: %+v, %v", got, err)
+	}
+
+	if err := store.PruneLogins(now); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.FindLogin("logins", []byte("expired"), false); got != nil || err != nil {
+		t.Errorf("found a pruned login: %+v, %v", got, err)
+	}
+	if got, err := store.FindLogin("logins", []byte("current"), false); got == nil || err != nil {
+		t.Errorf("pruned a current login: %+v, %v", got, err)
+	}
+}
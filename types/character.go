@@ -17,3 +17,16 @@ type Character struct {
 	Prestige map[string]int
 	Faction  string
 }
+
+// Game returns the name of the game that the system's scenarios belong to, as used in Session.Game.
+func (s System) Game() string {
+	switch s {
+	case Pathfinder, PathfinderCore:
+		return "Pathfinder"
+	case Starfinder:
+		return "Starfinder"
+	case Pathfinder2:
+		return "Pathfinder2"
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// Roles by which a Filter can select sessions.
+const (
+	RolePlayer = "player"
+	RoleGM     = "gm"
+)
+
+// Filter selects sessions. The zero Filter selects every session.
+type Filter struct {
+	// Game, if non-empty, selects sessions of that game, ignoring case.
+	Game string
+	// Season, if non-nil, selects sessions of that season.
+	Season *int
+	// Character, if non-zero, selects sessions played or GMed with that character number.
+	Character int
+	// Role, if non-empty, selects sessions played (RolePlayer) or GMed (RoleGM).
+	Role string
+	// From and To, if non-zero, select sessions on or after From and before To. Sessions with no date are selected
+	// only if both are zero.
+	From time.Time
+	To   time.Time
+	// Name, if non-empty, selects sessions whose scenario name contains it, ignoring case.
+	Name string
+}
+
+// Match returns true if the filter selects the session.
+func (f Filter) Match(s *Session) bool {
+	if f.Game != "" && !strings.EqualFold(f.Game, s.Game) {
+		return false
+	}
+	if f.Season != nil && *f.Season != s.Season {
+		return false
+	}
+	if f.Character != 0 && !containsInt(s.Character, f.Character) && !containsInt(s.Character, -f.Character) {
+		return false
+	}
+	if (!f.From.IsZero() || !f.To.IsZero()) && s.Date.IsZero() {
+		return false
+	}
+	if !f.From.IsZero() && s.Date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !s.Date.Before(f.To) {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(strings.ToLower(s.ScenarioName), strings.ToLower(f.Name)) {
+		return false
+	}
+	switch f.Role {
+	case RolePlayer:
+		return s.Player
+	case RoleGM:
+		return s.GM
+	}
+	return true
+}
+
+// Apply returns the sessions that the filter selects, in the same order.
+func (f Filter) Apply(sessions []*Session) []*Session {
+	ret := []*Session{}
+	for _, s := range sessions {
+		if f.Match(s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,87 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(d int) time.Time {
+	return time.Date(2018, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+var testSessions = []*Session{
+	{ScenarioName: "a: The Absalom Initiation", Date: day(3), Game: "Pathfinder2", Season: 1, Number: 1,
+		Character: []int{2001}, Player: true, Prestige: 4, EventNumber: []int64{30}},
+	{ScenarioName: "b: Dawn of the Scarlet Sun", Date: day(1), Game: "Pathfinder", Season: 9, Number: 1,
+		Character: []int{2}, Player: true, Prestige: 2, EventNumber: []int64{10, 50}},
+	{ScenarioName: "c: The Confirmation", Date: day(2), Game: "Pathfinder", Season: 5, Number: 8,
+		Character: []int{-1}, GM: true, Prestige: 2, EventNumber: []int64{20}},
+	{ScenarioName: "d: We Be Goblins!", Game: "Pathfinder", Season: -1, Character: []int{1, -2}, Player: true,
+		GM: true},
+}
+
+// names returns the letters that start the names of the given sessions.
+func names(sessions []*Session) string {
+	ret := []string{}
+	for _, s := range sessions {
+		ret = append(ret, s.ScenarioName[:1])
+	}
+	return strings.Join(ret, "")
+}
+
+func TestFilter(t *testing.T) {
+	five := 5
+	cases := []struct {
+		Name   string
+		Filter Filter
+		Want   string
+	}{
+		{"zero", Filter{}, "abcd"},
+		{"game ignores case", Filter{Game: "pathfinder"}, "bcd"},
+		{"season", Filter{Season: &five}, "c"},
+		{"character played or GMed", Filter{Character: 2}, "bd"},
+		{"player", Filter{Role: RolePlayer}, "abd"},
+		{"GM", Filter{Role: RoleGM}, "cd"},
+		{"from excludes undated", Filter{From: day(2)}, "ac"},
+		{"to is exclusive", Filter{To: day(2)}, "b"},
+		{"name ignores case", Filter{Name: "the"}, "abc"},
+		{"combined", Filter{Game: "Pathfinder", Role: RolePlayer, Character: 2}, "bd"},
+	}
+	for _, tc := range cases {
+		if got := names(tc.Filter.Apply(testSessions)); got != tc.Want {
+			t.Errorf("%s: got %q, want %q", tc.Name, got, tc.Want)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	cases := []struct {
+		Order Order
+		Want  string
+	}{
+		{Order{}, "abcd"},
+		{Order{Key: SortDate}, "dbca"},
+		{Order{Key: SortDate, Descending: true}, "acbd"},
+		// ties keep their order, whichever way they are sorted
+		{Order{Key: SortGame}, "bcda"},
+		{Order{Key: SortPrestige, Descending: true}, "abcd"},
+		// lowest event number ascending, highest descending
+		{Order{Key: SortEvent}, "dbca"},
+		{Order{Key: SortEvent, Descending: true}, "bacd"},
+		// played, then GMed, then both
+		{Order{Key: SortRole}, "abcd"},
+		{Order{Key: SortCharacter}, "cdba"},
+	}
+	for _, tc := range cases {
+		if err := tc.Order.Check(); err != nil {
+			t.Errorf("%+v: %v", tc.Order, err)
+		}
+		if got := names(tc.Order.Sort(testSessions)); got != tc.Want {
+			t.Errorf("%+v: got %q, want %q", tc.Order, got, tc.Want)
+		}
+	}
+	if err := (Order{Key: "fun"}).Check(); err == nil {
+		t.Error("unknown sort key was accepted")
+	}
+}
@@ -1,24 +1,129 @@
 package types
 
 import (
+	"fmt"
 	"time"
 )
 
 type Job struct {
-	JobId      string
-	State      string
-	Sessions   []*Session
+	JobId    string
+	State    string
+	Sessions []*Session
+	// Plays holds each row of All Sessions as a separate session; Sessions is the same data merged by DeDupe.
+	Plays      []*Session
 	Email      string `json:"-"`
 	Pass       string `json:"-"`
 	Messages   []*JobMessage
 	JobDate    time.Time
 	Characters []Character
+	// Owner identifies the job's Paizo account without its email address, or is empty for imported jobs.
+	Owner string `json:",omitempty"`
+	// Schema is the version of the format in which the job was stored.
+	Schema int `json:",omitempty"`
 }
 
 const (
-	JobStateDone = "done"
+	JobStateDone      = "done"
+	JobStateError     = "error"
+	JobStateCancelled = "cancelled"
 )
 
 func (j Job) Done() bool {
 	return j.State == JobStateDone
 }
+
+// Finished returns true if the job is no longer running; i.e., if it is done, has failed, or was cancelled.
+func (j Job) Finished() bool {
+	return j.State == JobStateDone || j.State == JobStateError || j.State == JobStateCancelled
+}
+
+// Modes in which a job's sessions can be listed; see SessionsFor.
+const (
+	// ModeMerged lists one session per scenario, as merged by DeDupe.
+	ModeMerged = "merged"
+	// ModePlays lists each play separately, oldest first.
+	ModePlays = "plays"
+	// ModeGrouped lists each play separately, grouped by scenario; see Group.
+	ModeGrouped = "grouped"
+)
+
+// CheckMode returns an error if mode is not one of the Mode* constants, or empty.
+func CheckMode(mode string) error {
+	switch mode {
+	case "", ModeMerged, ModePlays, ModeGrouped:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q; expected %q, %q, or %q", mode, ModeMerged, ModePlays, ModeGrouped)
+}
+
+// SessionsFor returns the job's sessions listed in the given mode. An empty mode is ModeMerged.
+func (j Job) SessionsFor(mode string) ([]*Session, error) {
+	switch mode {
+	case "", ModeMerged:
+		return j.Sessions, nil
+	case ModePlays:
+		return SortByDate(j.AllPlays()), nil
+	case ModeGrouped:
+		plays := []*Session{}
+		for _, group := range Group(j.AllPlays()) {
+			plays = append(plays, group.Plays...)
+		}
+		return plays, nil
+	}
+	return nil, CheckMode(mode)
+}
+
+// Select returns the job's sessions listed in the given mode, filtered and sorted; see SelectGroups for ModeGrouped.
+func (j Job) Select(mode string, filter Filter, order Order) ([]*Session, error) {
+	switch mode {
+	case "", ModeMerged, ModePlays:
+		sessions, err := j.SessionsFor(mode)
+		if err != nil {
+			return nil, err
+		}
+		return order.Sort(filter.Apply(sessions)), nil
+	case ModeGrouped:
+		plays := []*Session{}
+		for _, group := range j.SelectGroups(filter, order) {
+			plays = append(plays, group.Plays...)
+		}
+		return plays, nil
+	}
+	return j.SessionsFor(mode)
+}
+
+// SelectGroups groups the job's plays selected by the filter, as Group does, and sorts the groups by their merged
+// sessions in the given order.
+func (j Job) SelectGroups(filter Filter, order Order) []*SessionGroup {
+	groups := Group(filter.Apply(j.AllPlays()))
+	merged := make([]*Session, len(groups))
+	byMerged := map[*Session]*SessionGroup{}
+	for i, group := range groups {
+		merged[i] = group.Session
+		byMerged[group.Session] = group
+	}
+	for i, session := range order.Sort(merged) {
+		groups[i] = byMerged[session]
+	}
+	return groups
+}
+
+// AllPlays returns the job's individual plays; or, for jobs saved before those were recorded, its merged sessions.
+func (j Job) AllPlays() []*Session {
+	if j.Plays != nil {
+		return j.Plays
+	}
+	return j.Sessions
+}
+
+// JobFromSessions returns a job made from the given sessions, keeping them as Plays if each is a single play.
+func JobFromSessions(sessions []*Session) *Job {
+	job := &Job{Sessions: DeDupe(sessions)}
+	for _, s := range sessions {
+		if len(s.Character) > 1 || len(s.EventNumber) > 1 {
+			return job
+		}
+	}
+	job.Plays = SortByDate(sessions)
+	return job
+}
@@ -8,3 +8,21 @@ type JobMessage struct {
 	Message string
 	State   string
 }
+
+// Types of JobFrame.
+const (
+	// FrameMessage frames carry a JobMessage.
+	FrameMessage = "message"
+	// FrameCharacter frames carry a Character, sent as soon as the job has read it.
+	FrameCharacter = "character"
+	// FrameSession frames carry a Session, one play each, sent as soon as the job has read it.
+	FrameSession = "session"
+)
+
+// JobFrame is sent over a job's status websocket. Type says which one of Message, Character, or Session is set.
+type JobFrame struct {
+	Type      string
+	Message   *JobMessage `json:",omitempty"`
+	Character *Character  `json:",omitempty"`
+	Session   *Session    `json:",omitempty"`
+}
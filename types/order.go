@@ -0,0 +1,135 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Keys by which an Order sorts sessions, one for each column of the HTML view.
+const (
+	SortDate      = "date"
+	SortGame      = "game"
+	SortEvent     = "event"
+	SortCharacter = "character"
+	SortSeason    = "season"
+	SortNumber    = "number"
+	SortVariant   = "variant"
+	SortType      = "type"
+	SortName      = "name"
+	SortRole      = "role"
+	SortPrestige  = "prestige"
+	SortPoints    = "points"
+	SortFaction   = "faction"
+)
+
+// Order sorts sessions by one of the Sort* keys. The zero Order leaves sessions in the order they are in.
+type Order struct {
+	Key        string
+	Descending bool
+}
+
+// sessionCompare compares two sessions, returning a negative number if a sorts first. Event and character numbers
+// are compared by their lowest number when sorting in ascending order, and by their highest when descending.
+type sessionCompare func(a, b *Session, descending bool) int
+
+var sessionCompares = map[string]sessionCompare{
+	SortDate: func(a, b *Session, _ bool) int {
+		switch {
+		case a.Date.Before(b.Date):
+			return -1
+		case b.Date.Before(a.Date):
+			return 1
+		}
+		return 0
+	},
+	SortGame: func(a, b *Session, _ bool) int { return strings.Compare(a.Game, b.Game) },
+	SortEvent: func(a, b *Session, descending bool) int {
+		return extreme64(a.EventNumber, descending) - extreme64(b.EventNumber, descending)
+	},
+	SortCharacter: func(a, b *Session, descending bool) int {
+		return extreme(a.Character, descending) - extreme(b.Character, descending)
+	},
+	SortSeason:   func(a, b *Session, _ bool) int { return a.Season - b.Season },
+	SortNumber:   func(a, b *Session, _ bool) int { return a.Number - b.Number },
+	SortVariant:  func(a, b *Session, _ bool) int { return strings.Compare(a.Variant, b.Variant) },
+	SortType:     func(a, b *Session, _ bool) int { return strings.Compare(a.Type, b.Type) },
+	SortName:     func(a, b *Session, _ bool) int { return strings.Compare(a.ScenarioName, b.ScenarioName) },
+	SortRole:     func(a, b *Session, _ bool) int { return role(a) - role(b) },
+	SortPrestige: func(a, b *Session, _ bool) int { return a.Prestige - b.Prestige },
+	SortPoints:   func(a, b *Session, _ bool) int { return a.Points - b.Points },
+	SortFaction:  func(a, b *Session, _ bool) int { return strings.Compare(a.Faction, b.Faction) },
+}
+
+// Check returns an error if the order's key is not one of the Sort* keys.
+func (o Order) Check() error {
+	if o.Key == "" {
+		return nil
+	}
+	if _, ok := sessionCompares[o.Key]; !ok {
+		keys := []string{}
+		for key := range sessionCompares {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("unknown sort %q; expected one of %s", o.Key, strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// Sort returns the sessions in order. Sessions that compare equal keep their relative order.
+func (o Order) Sort(in []*Session) []*Session {
+	out := append([]*Session(nil), in...)
+	compare, ok := sessionCompares[o.Key]
+	if !ok {
+		return out
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if o.Descending {
+			return compare(out[j], out[i], true) < 0
+		}
+		return compare(out[i], out[j], false) < 0
+	})
+	return out
+}
+
+// extreme returns the lowest of the absolute values of the numbers, or the highest if highest is true; or zero if
+// there are none.
+func extreme(numbers []int, highest bool) int {
+	ret := 0
+	for i, n := range numbers {
+		if n < 0 {
+			n = -n
+		}
+		if i == 0 || (highest && n > ret) || (!highest && n < ret) {
+			ret = n
+		}
+	}
+	return ret
+}
+
+// extreme64 is like extreme, for event numbers.
+func extreme64(numbers []int64, highest bool) int {
+	var ret int64
+	for i, n := range numbers {
+		if n < 0 {
+			n = -n
+		}
+		if i == 0 || (highest && n > ret) || (!highest && n < ret) {
+			ret = n
+		}
+	}
+	return int(ret)
+}
+
+// role orders sessions played, then those GMed, then those both played and GMed, as the HTML view does.
+func role(s *Session) int {
+	ret := 0
+	if s.Player {
+		ret++
+	}
+	if s.GM {
+		ret += 2
+	}
+	return ret
+}
@@ -8,6 +8,15 @@ import (
 	"time"
 )
 
+// Scenario types; see Session.Type.
+const (
+	TypeScenario = "Scenario"
+	TypeQuest    = "Quest"
+	TypeBounty   = "Bounty"
+	TypeSpecial  = "Special"
+	TypeModule   = "Module"
+)
+
 type Session struct {
 	Date         time.Time
 	EventNumber  []int64
@@ -16,9 +25,18 @@ type Session struct {
 	Number       int
 	Variant      string
 	ScenarioName string
-	Character    []int
-	Player       bool
-	GM           bool
+	// Type is one of the Type* constants, or empty if the kind of adventure is not known. Quests and Bounties are
+	// not part of a season, and are recorded with Season 0.
+	Type      string
+	Character []int
+	Player    bool
+	GM        bool
+	// Prestige is the prestige or reputation earned, and Points the value of the Points column; for merged sessions
+	// (see DeDupe), these are totals.
+	Prestige int
+	Points   int
+	// Faction is the faction credited; merged sessions list each distinct faction, separated by ", ".
+	Faction string
 }
 
 func (s Session) String() (ret string) {
@@ -73,9 +91,83 @@ func (s Session) Record() (ret []string) {
 	} else {
 		ret = append(ret, "GM")
 	}
+	ret = append(ret, s.Type, strconv.Itoa(s.Prestige), strconv.Itoa(s.Points), s.Faction)
 	return ret
 }
 
+// ParseRecord is the reverse of Record, accepting older records without the newer columns. Game is left empty.
+func ParseRecord(record []string) (*Session, error) {
+	if len(record) < 8 {
+		return nil, fmt.Errorf("expected at least 8 fields, but got %d", len(record))
+	}
+
+	s := &Session{Variant: record[5], ScenarioName: record[6]}
+	if record[0] != "MISSING" {
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing date %q: %v", record[0], err)
+		}
+		s.Date = date
+	}
+
+	for _, e := range strings.Fields(record[1]) {
+		event, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing event number %q: %v", e, err)
+		}
+		s.EventNumber = append(s.EventNumber, event)
+	}
+
+	for _, c := range strings.Fields(record[2]) {
+		if c == "GM" {
+			s.Character = append(s.Character, -2)
+			continue
+		}
+		char, err := strconv.Atoi(c)
+		if err != nil {
+			return nil, fmt.Errorf("parsing character number %q: %v", c, err)
+		}
+		s.Character = append(s.Character, char)
+	}
+
+	var err error
+	if s.Season, err = strconv.Atoi(record[3]); err != nil {
+		return nil, fmt.Errorf("parsing season %q: %v", record[3], err)
+	}
+	if s.Number, err = strconv.Atoi(record[4]); err != nil {
+		return nil, fmt.Errorf("parsing scenario number %q: %v", record[4], err)
+	}
+
+	switch record[7] {
+	case "P/GM":
+		s.Player, s.GM = true, true
+	case "P":
+		s.Player = true
+	case "GM":
+		s.GM = true
+	default:
+		return nil, fmt.Errorf("expected P, GM, or P/GM, but got %q", record[7])
+	}
+
+	if len(record) >= 12 {
+		s.Type = record[8]
+		if record[9] != "" {
+			if s.Prestige, err = strconv.Atoi(record[9]); err != nil {
+				return nil, fmt.Errorf("parsing prestige %q: %v", record[9], err)
+			}
+		}
+		if record[10] != "" {
+			if s.Points, err = strconv.Atoi(record[10]); err != nil {
+				return nil, fmt.Errorf("parsing points %q: %v", record[10], err)
+			}
+		}
+		s.Faction = record[11]
+	}
+	return s, nil
+}
+
+// DeDupe merges sessions that have the same ScenarioName into a single session, combining their characters, event
+// numbers, and rewards and keeping the date of the first one. The input sessions are not modified.
 func DeDupe(in []*Session) (out []*Session) {
 	sessionsByName := map[string]*Session{}
 	for _, session := range in {
@@ -88,13 +180,26 @@ func DeDupe(in []*Session) (out []*Session) {
 			if previous.Game == "" {
 				previous.Game = session.Game
 			}
+			if previous.Type == "" {
+				previous.Type = session.Type
+			}
+			previous.Prestige += session.Prestige
+			previous.Points += session.Points
+			previous.Faction = mergeFactions(previous.Faction, session.Faction)
 		} else {
-			sessionsByName[session.ScenarioName] = session
+			merged := *session
+			merged.Character = append([]int(nil), session.Character...)
+			merged.EventNumber = append([]int64(nil), session.EventNumber...)
+			sessionsByName[session.ScenarioName] = &merged
 		}
 	}
 
 	out = []*Session{}
 	for _, session := range sessionsByName {
+		sort.Slice(session.EventNumber, func(i, j int) bool {
+			return session.EventNumber[i] < session.EventNumber[j]
+		})
+		sort.Ints(session.Character)
 		out = append(out, session)
 	}
 	sort.Slice(out, func(i, j int) bool {
@@ -102,3 +207,87 @@ func DeDupe(in []*Session) (out []*Session) {
 	})
 	return out
 }
+
+// Covers returns true if the given play is already part of s: that is, if s is the same scenario, in the same role
+// (player or GM), and lists the play's characters and event numbers. s may be a single play or a merged session.
+func (s *Session) Covers(play *Session) bool {
+	if s.ScenarioName != play.ScenarioName || (play.GM && !s.GM) || (play.Player && !s.Player) {
+		return false
+	}
+	for _, char := range play.Character {
+		if !containsInt(s.Character, char) {
+			return false
+		}
+	}
+	for _, event := range play.EventNumber {
+		if !containsInt64(s.EventNumber, event) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsInt(list []int, i int) bool {
+	for _, l := range list {
+		if l == i {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(list []int64, i int64) bool {
+	for _, l := range list {
+		if l == i {
+			return true
+		}
+	}
+	return false
+}
+
+// SortByDate returns a copy of the given list of sessions, sorted oldest first.
+func SortByDate(in []*Session) []*Session {
+	out := append([]*Session(nil), in...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Date.Before(out[j].Date)
+	})
+	return out
+}
+
+// SessionGroup is one scenario: the merged session as produced by DeDupe, and each individual play that it was made
+// from.
+type SessionGroup struct {
+	Session *Session
+	Plays   []*Session
+}
+
+// Group groups individual plays by ScenarioName. Groups are ordered as DeDupe would order them, and plays within a
+// group are ordered by date.
+func Group(plays []*Session) []*SessionGroup {
+	playsByName := map[string][]*Session{}
+	for _, play := range SortByDate(plays) {
+		playsByName[play.ScenarioName] = append(playsByName[play.ScenarioName], play)
+	}
+
+	groups := []*SessionGroup{}
+	for _, merged := range DeDupe(plays) {
+		groups = append(groups, &SessionGroup{Session: merged, Plays: playsByName[merged.ScenarioName]})
+	}
+	return groups
+}
+
+// mergeFactions adds the faction b to the ", "-separated list of factions a, if it is not already present.
+func mergeFactions(a, b string) string {
+	if b == "" {
+		return a
+	}
+	if a == "" {
+		return b
+	}
+	for _, f := range strings.Split(a, ", ") {
+		if f == b {
+			return a
+		}
+	}
+	return a + ", " + b
+}